@@ -0,0 +1,118 @@
+package brick
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/rs/zerolog"
+)
+
+// BatchConfig config of query batching
+type BatchConfig struct {
+	// MaxSize of a batch, 10 if zero, batching is disabled if negative
+	MaxSize int
+	// Concurrency of operations of a batch, 4 if zero
+	Concurrency int
+}
+
+// Batching config query batching: a JSON array of operations is posted,
+// and an array of results is returned in the same order
+func (g *Graphql) Batching(cfg *BatchConfig) *Graphql {
+	c := *cfg
+	if c.MaxSize == 0 {
+		c.MaxSize = 10
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = 4
+	}
+	g.batch = &c
+	return g
+}
+
+func (e *graphqlEndpoint) checkBatch(list []*graphqlParams, stream bool) *graphqlRequestError {
+	if e.batch.MaxSize < 0 {
+		return &graphqlRequestError{status: http.StatusBadRequest, message: "batching is disabled"}
+	}
+	if stream {
+		return &graphqlRequestError{status: http.StatusBadRequest, message: "batching is not supported by text/event-stream"}
+	}
+	if len(list) > e.batch.MaxSize {
+		return &graphqlRequestError{
+			status:  http.StatusBadRequest,
+			message: fmt.Sprintf("batch of %d operations exceeds the limit of %d", len(list), e.batch.MaxSize),
+		}
+	}
+	return nil
+}
+
+// serveBatch execute operations with bounded concurrency, every operation
+// has its own access log and span, and fails alone
+func (e *graphqlEndpoint) serveBatch(ctx context.Context, mediaType string, list []*graphqlParams) {
+	w := Response(ctx)
+
+	results := make([]*graphql.Response, len(list))
+	sem := make(chan struct{}, e.batch.Concurrency)
+	var wg sync.WaitGroup
+
+	for i, params := range list {
+		// the access log of the request, with the position in the batch
+		access := make(map[string]string)
+		for k, v := range Access(ctx) {
+			access[k] = v
+		}
+		access["batch"] = fmt.Sprintf("%d/%d", i+1, len(list))
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, params *graphqlParams) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			start := time.Now()
+			is500 := false
+			defer func() {
+				if err := recover(); err != nil {
+					log.Error().Interface("panic", err).Msg("graphql batch")
+					is500 = true
+					results[i] = &graphql.Response{
+						Errors: []*gqlerrors.QueryError{{Message: "masked panic"}},
+					}
+				}
+
+				var entry *zerolog.Event
+				if is500 {
+					entry = log.Error()
+				} else {
+					entry = log.Info()
+				}
+				for k, v := range access {
+					entry.Str(k, v)
+				}
+				entry.Dur("duration", time.Now().Sub(start)).Msg("access")
+			}()
+
+			if reqErr := e.prepare(ctx, params, false, access); reqErr != nil {
+				results[i] = reqErr.response()
+				return
+			}
+			results[i], is500 = e.execute(ctx, params, access)
+		}(i, params)
+	}
+	wg.Wait()
+
+	body, err := json.Marshal(results)
+	if err != nil {
+		log.Panic().Err(err).Send()
+	}
+
+	// 200 for the batch, as operations fail alone
+	w.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
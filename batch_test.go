@@ -0,0 +1,58 @@
+package brick
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestBatch(t *testing.T) {
+	g := NewGraphql(&relayResolver{})
+	g.Schema(`
+	type Query {
+		greeting(name: String): String!
+		boom: String!
+		business: String!
+	}
+	`)
+	g.Batching(&BatchConfig{MaxSize: 4, Concurrency: 2})
+	r := New()
+	r.Graphql("/graphql", g)
+
+	post := func(body string) (int, string) {
+		req := httptest.NewRequest("POST", "/graphql", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	status, body := post(`[
+		{"query":"{ greeting }"},
+		{"query":"query($name: String) { greeting(name: $name) }","variables":{"name":"bob"}},
+		{"query":"{ boom }"},
+		{"query":"{ business }"}
+	]`)
+	assert.Equal(t, 200, status)
+	assert.Equal(
+		t,
+		`[{"data":{"greeting":"hello world"}},`+
+			`{"data":{"greeting":"hello bob"}},`+
+			`{"errors":[{"message":"masked panic","path":["boom"]}],"data":null},`+
+			`{"errors":[{"message":"business","path":["business"],"extensions":{"code":10001}}],"data":null}]`,
+		body,
+	)
+
+	status, body = post(`[{"query":"{ greeting }"},{},{"query":"{ greeting }"},{"query":"{ greeting }"},{"query":"{ greeting }"}]`)
+	assert.Equal(t, 400, status)
+	assert.Contains(t, body, "batch of 5 operations exceeds the limit of 4")
+
+	status, body = post(`[{"query":"{ greeting }"},{}]`)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, `[{"data":{"greeting":"hello world"}},{"errors":[{"message":"query is required"}]}]`, body)
+
+	status, _ = post(`[]`)
+	assert.Equal(t, 400, status)
+}
@@ -0,0 +1,263 @@
+package brick
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// BindError is returned by Bind on bad input, it has the same
+// code/msg shape as BusinessError, with the details of each field
+type BindError struct {
+	Code   int          `json:"code" xml:"code"`
+	Msg    string       `json:"msg" xml:"msg"`
+	Fields []FieldError `json:"fields,omitempty" xml:"fields>field,omitempty"`
+}
+
+// FieldError describe why a field is rejected
+type FieldError struct {
+	Field string `json:"field" xml:"name,attr"`
+	Msg   string `json:"msg" xml:",chardata"`
+}
+
+func (e *BindError) Error() string {
+	b, _ := json.Marshal(e)
+	return string(b)
+}
+
+func newBindError(fields []FieldError) *BindError {
+	msgs := make([]string, 0, len(fields))
+	for _, f := range fields {
+		msgs = append(msgs, f.Field+": "+f.Msg)
+	}
+	return &BindError{
+		Code:   http.StatusBadRequest,
+		Msg:    strings.Join(msgs, "; "),
+		Fields: fields,
+	}
+}
+
+// max memory for multipart form, the rest is stored in temporary files
+const maxMultipartMemory = 32 << 20
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+)
+
+// Bind fill v, a pointer to struct, from the request, then validate it.
+//
+// A JSON body is decoded into the fields of v without the struct tags
+// below (by json tags), then the other fields are filled by these tags:
+//
+//	path:"id"       path param of httprouter
+//	query:"page"    url query
+//	header:"X-Key"  request header
+//	form:"name"     urlencoded or multipart form,
+//	                *multipart.FileHeader or []*multipart.FileHeader for files
+//
+// Supported field types are strings, bools, numbers, pointers and slices
+// of them, and encoding.TextUnmarshaler. Embedded structs are flattened.
+// See Validate for the validate tag.
+//
+// A *BindError is returned on bad input.
+func Bind(ctx context.Context, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		log.Panic().Msgf("expect a pointer to struct, but get %T", v)
+	}
+
+	r := Request(ctx)
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch contentType {
+	case "application/json":
+		if r.Body != nil {
+			// the body must not set fields bound from elsewhere
+			tagged := boundFields(rv.Elem(), nil)
+			saved := make([]reflect.Value, len(tagged))
+			for i, fv := range tagged {
+				saved[i] = reflect.New(fv.Type()).Elem()
+				saved[i].Set(fv)
+			}
+
+			err := json.NewDecoder(r.Body).Decode(v)
+			if err != nil && err != io.EOF {
+				return newBindError([]FieldError{{Field: "body", Msg: err.Error()}})
+			}
+
+			for i, fv := range tagged {
+				fv.Set(saved[i])
+			}
+		}
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(maxMultipartMemory); err != nil {
+			return newBindError([]FieldError{{Field: "body", Msg: err.Error()}})
+		}
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return newBindError([]FieldError{{Field: "body", Msg: err.Error()}})
+		}
+	}
+
+	var fields []FieldError
+	bindStruct(ctx, r, rv.Elem(), &fields)
+	if len(fields) > 0 {
+		return newBindError(fields)
+	}
+
+	return Validate(v)
+}
+
+// MustBind is like Bind, but responds 400 with the BindError and
+// stops the handler on bad input (by a panic caught in recover middleware)
+func MustBind(ctx context.Context, v interface{}) {
+	if err := Bind(ctx, v); err != nil {
+		panic(err)
+	}
+}
+
+// bindTags are the struct tags which bind a field from the request
+var bindTags = []string{"path", "query", "header", "form"}
+
+// boundFields append the exported fields of rv with a bind tag to fvs
+func boundFields(rv reflect.Value, fvs []reflect.Value) []reflect.Value {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			fvs = boundFields(rv.Field(i), fvs)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		for _, tag := range bindTags {
+			if sf.Tag.Get(tag) != "" {
+				fvs = append(fvs, rv.Field(i))
+				break
+			}
+		}
+	}
+	return fvs
+}
+
+func bindStruct(ctx context.Context, r *http.Request, rv reflect.Value, fields *[]FieldError) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		fv := rv.Field(i)
+
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			bindStruct(ctx, r, fv, fields)
+			continue
+		}
+		if sf.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		var values []string
+		var name string
+		if name = sf.Tag.Get("path"); name != "" {
+			if p := Params(ctx).ByName(name); p != "" {
+				values = []string{p}
+			}
+		} else if name = sf.Tag.Get("query"); name != "" {
+			values = r.URL.Query()[name]
+		} else if name = sf.Tag.Get("header"); name != "" {
+			values = r.Header.Values(name)
+		} else if name = sf.Tag.Get("form"); name != "" {
+			if sf.Type == fileHeaderType || sf.Type == reflect.SliceOf(fileHeaderType) {
+				if r.MultipartForm != nil && len(r.MultipartForm.File[name]) > 0 {
+					files := r.MultipartForm.File[name]
+					if sf.Type == fileHeaderType {
+						fv.Set(reflect.ValueOf(files[0]))
+					} else {
+						fv.Set(reflect.ValueOf(files))
+					}
+				}
+				continue
+			}
+			values = r.PostForm[name]
+		} else {
+			continue
+		}
+
+		if len(values) == 0 {
+			continue
+		}
+		if err := setValues(fv, values); err != nil {
+			*fields = append(*fields, FieldError{Field: name, Msg: err.Error()})
+		}
+	}
+}
+
+func setValues(fv reflect.Value, values []string) error {
+	if fv.Kind() == reflect.Slice && !fv.Addr().Type().Implements(textUnmarshalerType) {
+		slice := reflect.MakeSlice(fv.Type(), len(values), len(values))
+		for i, s := range values {
+			if err := setValue(slice.Index(i), s); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+	return setValue(fv, values[0])
+}
+
+func setValue(fv reflect.Value, s string) error {
+	if fv.Kind() == reflect.Ptr {
+		v := reflect.New(fv.Type().Elem())
+		if err := setValue(v.Elem(), s); err != nil {
+			return err
+		}
+		fv.Set(v)
+		return nil
+	}
+
+	if fv.CanAddr() && fv.Addr().Type().Implements(textUnmarshalerType) {
+		return fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("expect a bool, but get %q", s)
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expect an integer, but get %q", s)
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expect an unsigned integer, but get %q", s)
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expect a number, but get %q", s)
+		}
+		fv.SetFloat(n)
+	default:
+		log.Panic().Msgf("unsupported field type %s", fv.Type())
+	}
+	return nil
+}
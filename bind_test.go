@@ -0,0 +1,178 @@
+package brick
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+type bindAddress struct {
+	City string `json:"city" validate:"required"`
+}
+
+type bindPaging struct {
+	Page int `query:"page" validate:"min=1"`
+}
+
+type bindInput struct {
+	bindPaging
+	ID       int64         `path:"id" validate:"required,min=1"`
+	Tags     []string      `query:"tag" validate:"max=2"`
+	Token    *string       `header:"X-Token"`
+	Name     string        `json:"name" validate:"required,max=5"`
+	Role     string        `json:"role" validate:"enum=admin|user"`
+	Code     string        `json:"code" validate:"regex=^[a-z]+,[0-9]+$"`
+	Address  *bindAddress  `json:"address"`
+	Contacts []bindAddress `json:"contacts"`
+}
+
+func TestBind(t *testing.T) {
+	var in bindInput
+	var bindErr error
+
+	r := New()
+	r.POST("/user/:id", func(ctx context.Context) {
+		in = bindInput{}
+		bindErr = Bind(ctx, &in)
+	})
+
+	req := httptest.NewRequest("POST", "/user/12?page=2&tag=a&tag=b", strings.NewReader(
+		`{"name":"bob","role":"admin","code":"ab,12","address":{"city":"gz"}}`,
+	))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Token", "secret")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Nil(t, bindErr)
+	assert.Equal(t, int64(12), in.ID)
+	assert.Equal(t, 2, in.Page)
+	assert.Equal(t, []string{"a", "b"}, in.Tags)
+	assert.Equal(t, "secret", *in.Token)
+	assert.Equal(t, "bob", in.Name)
+	assert.Equal(t, "gz", in.Address.City)
+
+	req = httptest.NewRequest("POST", "/user/0?page=x&tag=a&tag=b&tag=c", strings.NewReader(
+		`{"name":"toolong","role":"root","code":"AB","contacts":[{"city":""}]}`,
+	))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	e, ok := bindErr.(*BindError)
+	assert.True(t, ok)
+	assert.Equal(t, 400, e.Code)
+	// conversion errors are reported before validation
+	assert.Equal(t, []FieldError{
+		{Field: "page", Msg: `expect an integer, but get "x"`},
+	}, e.Fields)
+
+	req = httptest.NewRequest("POST", "/user/0?tag=a&tag=b&tag=c", strings.NewReader(
+		`{"name":"toolong","role":"root","code":"AB","contacts":[{"city":""}]}`,
+	))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	e, ok = bindErr.(*BindError)
+	assert.True(t, ok)
+	assert.Equal(t, []FieldError{
+		{Field: "page", Msg: "must be at least 1"},
+		{Field: "id", Msg: "required"},
+		{Field: "tag", Msg: "length must be at most 2"},
+		{Field: "name", Msg: "length must be at most 5"},
+		{Field: "role", Msg: "must be one of admin, user"},
+		{Field: "code", Msg: "must match ^[a-z]+,[0-9]+$"},
+		{Field: "contacts[0].city", Msg: "required"},
+	}, e.Fields)
+
+	// the body can not set fields bound from path, query or header
+	req = httptest.NewRequest("POST", "/user/12?page=2", strings.NewReader(
+		`{"name":"bob","role":"user","code":"a,1","Token":"forged","ID":99,"Page":3,"Tags":["x"]}`,
+	))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Nil(t, bindErr)
+	assert.Nil(t, in.Token)
+	assert.Equal(t, int64(12), in.ID)
+	assert.Equal(t, 2, in.Page)
+	assert.Nil(t, in.Tags)
+	assert.Equal(t, "bob", in.Name)
+}
+
+func TestValidateZero(t *testing.T) {
+	type input struct {
+		Count int     `json:"count" validate:"min=1"`
+		Kind  string  `json:"kind" validate:"enum=a|b"`
+		Tags  []int   `json:"tags" validate:"min=1"`
+		Limit *int    `json:"limit" validate:"min=1"`
+		Sort  *string `json:"sort" validate:"enum=asc|desc"`
+	}
+
+	// zero values are checked, absent optional values are not
+	e, ok := Validate(&input{Tags: []int{}}).(*BindError)
+	assert.True(t, ok)
+	assert.Equal(t, []FieldError{
+		{Field: "count", Msg: "must be at least 1"},
+		{Field: "kind", Msg: "must be one of a, b"},
+		{Field: "tags", Msg: "length must be at least 1"},
+	}, e.Fields)
+
+	zero := 0
+	e, ok = Validate(&input{Count: 1, Kind: "a", Limit: &zero}).(*BindError)
+	assert.True(t, ok)
+	assert.Equal(t, []FieldError{{Field: "limit", Msg: "must be at least 1"}}, e.Fields)
+}
+
+func TestBindForm(t *testing.T) {
+	var in struct {
+		Title  string                  `form:"title" validate:"required"`
+		Avatar *multipart.FileHeader   `form:"avatar"`
+		Photos []*multipart.FileHeader `form:"photo"`
+	}
+
+	r := New()
+	r.POST("/upload", func(ctx context.Context) {
+		MustBind(ctx, &in)
+	})
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("title", "hello")
+	f, _ := mw.CreateFormFile("avatar", "a.png")
+	f.Write([]byte("png"))
+	f, _ = mw.CreateFormFile("photo", "1.jpg")
+	f.Write([]byte("jpg"))
+	f, _ = mw.CreateFormFile("photo", "2.jpg")
+	f.Write([]byte("jpg"))
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "hello", in.Title)
+	assert.Equal(t, "a.png", in.Avatar.Filename)
+	assert.Equal(t, 2, len(in.Photos))
+
+	// MustBind responds 400 with the BindError
+	req = httptest.NewRequest("POST", "/upload", strings.NewReader("title="))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	var e BindError
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &e))
+	assert.Equal(t, BindError{
+		Code:   400,
+		Msg:    "title: required",
+		Fields: []FieldError{{Field: "title", Msg: "required"}},
+	}, e)
+}
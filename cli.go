@@ -0,0 +1,249 @@
+package brick
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	yaml "go.yaml.in/yaml/v3"
+)
+
+// command is a subcommand of Router.Run
+type command struct {
+	usage string
+	run   func(r *Router, args []string, out io.Writer) error
+}
+
+var commands = map[string]*command{
+	"routes": {
+		usage: "list registered routes, -json for JSON output",
+		run:   routesCommand,
+	},
+	"openapi": {
+		usage: "print the OpenAPI document, -yaml for YAML output",
+		run:   openapiCommand,
+	},
+	"graphql": {
+		usage: "print the SDL or introspection JSON of a graphql endpoint, or diff it with an older SDL",
+		run:   graphqlCommand,
+	},
+}
+
+// Run dispatch the command line of the binary:
+//
+//	app [serve]        ListenAndServe
+//	app routes [-json] list registered routes
+//	app openapi [-yaml] print the OpenAPI document
+//	app graphql [-path /graphql] sdl|introspect|diff
+//	                    print the SDL, the introspection JSON, or the
+//	                    changes since an older SDL of a graphql endpoint
+//
+// so that a binary can tell what it serves without starting the server
+func (r *Router) Run() error {
+	return r.run(os.Args[1:], os.Stdout)
+}
+
+func (r *Router) run(args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] == "serve" {
+		return r.ListenAndServe()
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		names := []string{"serve"}
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return errors.New("unknown command " + args[0] + ", expect one of: " + strings.Join(names, ", "))
+	}
+
+	return cmd.run(r, args[1:], out)
+}
+
+func routesCommand(r *Router, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("routes", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "output as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	routes := r.Routes()
+	if *asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(routes)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "METHOD\tPATH\tHANDLER\tMIDDLEWARES\tCORS\tSOURCE")
+	for _, route := range routes {
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\t%s\t%t\t%s\n",
+			route.Method,
+			route.Path,
+			route.Handler,
+			strings.Join(route.Middlewares, ","),
+			route.CORS,
+			route.Source,
+		)
+	}
+	return w.Flush()
+}
+
+func openapiCommand(r *Router, args []string, out io.Writer) error {
+	info := OpenAPIInfo{Title: "API", Version: "0.0.0"}
+	r.routes.Lock()
+	if r.routes.openapi != nil {
+		info = *r.routes.openapi
+	}
+	r.routes.Unlock()
+
+	fs := flag.NewFlagSet("openapi", flag.ContinueOnError)
+	asYAML := fs.Bool("yaml", false, "output as YAML")
+	fs.StringVar(&info.Title, "title", info.Title, "title of the document")
+	fs.StringVar(&info.Version, "version", info.Version, "version of the document")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	doc := r.OpenAPIDocument(info)
+	if *asYAML {
+		enc := yaml.NewEncoder(out)
+		enc.SetIndent(2)
+		return enc.Encode(doc)
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func graphqlCommand(r *Router, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("graphql", flag.ContinueOnError)
+	path := fs.String("path", "", "path of the graphql endpoint, required if there are more than one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	r.routes.Lock()
+	endpoints := make(map[string]*graphqlEndpoint, len(r.routes.graphqls))
+	for p, e := range r.routes.graphqls {
+		endpoints[p] = e
+	}
+	r.routes.Unlock()
+
+	var e *graphqlEndpoint
+	if *path != "" {
+		e = endpoints[*path]
+		if e == nil {
+			return errors.New("no graphql endpoint on " + *path)
+		}
+	} else {
+		if len(endpoints) != 1 {
+			paths := []string{}
+			for p := range endpoints {
+				paths = append(paths, p)
+			}
+			sort.Strings(paths)
+			return fmt.Errorf("%d graphql endpoints (%s), choose one by -path", len(endpoints), strings.Join(paths, ", "))
+		}
+		for _, v := range endpoints {
+			e = v
+		}
+	}
+
+	sub := fs.Args()
+	if len(sub) == 0 {
+		return errors.New("expect graphql sdl, introspect or diff")
+	}
+	switch sub[0] {
+	case "sdl":
+		_, err := io.WriteString(out, e.SDL())
+		return err
+	case "introspect":
+		data, err := e.schema.ToJSON()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "%s\n", data)
+		return err
+	case "diff":
+		return graphqlDiffCommand(e, sub[1:], out)
+	}
+	return errors.New("unknown graphql command " + sub[0] + ", expect sdl, introspect or diff")
+}
+
+// graphqlDiffCommand print changes from the old SDL to the new one (the
+// schema of the endpoint by default), fail if any of them is breaking,
+// so that CI can stop changes breaking clients of older builds
+func graphqlDiffCommand(e *graphqlEndpoint, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("graphql diff", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "output as JSON")
+	dangerous := fs.Bool("fail-on-dangerous", false, "fail on dangerous changes too")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return errors.New("usage: graphql diff [-json] [-fail-on-dangerous] old.graphql [new.graphql]")
+	}
+
+	oldSDL, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	newSDL := e.SDL()
+	if fs.NArg() == 2 {
+		data, err := os.ReadFile(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		newSDL = string(data)
+	}
+
+	changes, err := DiffSchema(string(oldSDL), newSDL)
+	if err != nil {
+		return err
+	}
+
+	count := map[string]int{}
+	for _, c := range changes {
+		count[c.Level]++
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(changes); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		for _, c := range changes {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", strings.ToUpper(c.Level), c.Path, c.Message)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintf(
+			out,
+			"%d breaking, %d dangerous, %d safe changes\n",
+			count[SchemaChangeBreaking], count[SchemaChangeDangerous], count[SchemaChangeSafe],
+		)
+	}
+
+	if count[SchemaChangeBreaking] > 0 {
+		return fmt.Errorf("%d breaking changes", count[SchemaChangeBreaking])
+	}
+	if *dangerous && count[SchemaChangeDangerous] > 0 {
+		return fmt.Errorf("%d dangerous changes", count[SchemaChangeDangerous])
+	}
+	return nil
+}
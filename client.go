@@ -0,0 +1,305 @@
+package brick
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	ot "github.com/opentracing/opentracing-go"
+	otext "github.com/opentracing/opentracing-go/ext"
+	bl "github.com/pickjunk/brick/log"
+)
+
+var clientLog = bl.New("brick.client")
+
+// ClientConfig of outbound requests to a host, zero values are defaults
+type ClientConfig struct {
+	// Timeout of every attempt, reading the body included, 10s by default
+	Timeout time.Duration
+	// Retries of idempotent requests (GET, HEAD, OPTIONS, PUT, DELETE,
+	// or with an Idempotency-Key header) on network errors, timeouts,
+	// 429, 502, 503 and 504
+	Retries int
+	// Backoff before the nth retry, from 1, 100ms doubled every retry
+	// up to 3s, with jitter, by default
+	Backoff func(n int) time.Duration
+	// BreakerFailures of network errors and 5xx in a row open the
+	// circuit breaker of the host, 5 by default, -1 disables it
+	BreakerFailures int
+	// BreakerCooldown of an open breaker, after which a single request
+	// is let through to probe the host, 30s by default
+	BreakerCooldown time.Duration
+}
+
+// ErrCircuitOpen is returned without sending the request, when the
+// circuit breaker of the host is open
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// Client of outbound http requests, which injects the span context into
+// headers, logs every attempt, and applies timeouts, retries and a
+// circuit breaker by host. It is safe for concurrent use
+type Client struct {
+	// Transport of requests, http.DefaultTransport if nil
+	Transport http.RoundTripper
+	// Default config of hosts absent from Hosts
+	Default ClientConfig
+	// Hosts config by host of urls, e.g. api.weixin.qq.com or
+	// localhost:8080
+	Hosts map[string]*ClientConfig
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+// DefaultClient is shared by brick utils. Idempotent requests are retried
+// twice, and attempts time out in 1 minute, reading the body included, for
+// downloads (e.g. utils.DownloadImage), except wx apis, which are of small
+// bodies and time out in 10s. Set Default and Hosts before use to change them
+var DefaultClient = &Client{
+	Default: ClientConfig{Timeout: time.Minute, Retries: 2},
+	Hosts: map[string]*ClientConfig{
+		"api.weixin.qq.com": {Timeout: 10 * time.Second, Retries: 2},
+	},
+}
+
+func (c *Client) config(host string) ClientConfig {
+	cfg := c.Default
+	if h, ok := c.Hosts[host]; ok {
+		cfg = *h
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.BreakerFailures == 0 {
+		cfg.BreakerFailures = 5
+	}
+	if cfg.BreakerCooldown == 0 {
+		cfg.BreakerCooldown = 30 * time.Second
+	}
+	return cfg
+}
+
+func (c *Client) breaker(host string) *breaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.breakers == nil {
+		c.breakers = make(map[string]*breaker)
+	}
+	b, ok := c.breakers[host]
+	if !ok {
+		b = &breaker{}
+		c.breakers[host] = b
+	}
+	return b
+}
+
+// Do send r with the config of its host, operation names the span,
+// e.g. wx.fetch. The body of r is resent by r.GetBody on retries,
+// requests without GetBody are never retried
+func (c *Client) Do(ctx context.Context, operation string, r *http.Request) (*http.Response, error) {
+	host := r.URL.Host
+	cfg := c.config(host)
+	b := c.breaker(host)
+
+	retries := 0
+	if idempotent(r) && (r.Body == nil || r.Body == http.NoBody || r.GetBody != nil) {
+		retries = cfg.Retries
+	}
+
+	for n := 0; ; n++ {
+		if n > 0 && r.GetBody != nil {
+			body, err := r.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+		}
+
+		res, err := c.attempt(ctx, operation, r, cfg, b, n)
+		retry := false
+		if err != nil {
+			// timeouts of the attempt are transient, unless ctx is done
+			retry = err != ErrCircuitOpen && ctx.Err() == nil
+		} else {
+			switch res.StatusCode {
+			case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+				retry = true
+			}
+		}
+		if !retry || n >= retries {
+			return res, err
+		}
+		if res != nil {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		backoff := cfg.backoff(n + 1)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, operation string, r *http.Request, cfg ClientConfig, b *breaker, n int) (*http.Response, error) {
+	url := r.URL.Scheme + "://" + r.URL.Host + r.URL.Path
+	event := clientLog.Info()
+
+	if !b.allow(cfg) {
+		clientLog.Warn().Str("method", r.Method).Str("url", url).Msg("circuit breaker open")
+		return nil, ErrCircuitOpen
+	}
+
+	parent := ctx
+	span, ctx := ot.StartSpanFromContext(ctx, operation)
+	defer span.Finish()
+	otext.SpanKindRPCClient.Set(span)
+	otext.HTTPMethod.Set(span, r.Method)
+	// without the query, which may carry tokens
+	otext.HTTPUrl.Set(span, url)
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	req := r.WithContext(ctx)
+	req.Header = r.Header.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	InjectHTTPHeaders(span.Context(), req.Header)
+
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	start := time.Now()
+	res, err := transport.RoundTrip(req)
+	duration := time.Now().Sub(start)
+
+	if err != nil {
+		cancel()
+		if parent.Err() != nil {
+			// canceled by the caller, not a failure of the host
+			b.release()
+		} else {
+			b.done(cfg, false)
+		}
+		otext.Error.Set(span, true)
+		span.SetTag("error.message", err.Error())
+		event = clientLog.Warn().Err(err)
+	} else {
+		// the timeout covers reading the body
+		res.Body = &cancelBody{res.Body, cancel}
+		b.done(cfg, res.StatusCode < 500)
+		otext.HTTPStatusCode.Set(span, uint16(res.StatusCode))
+		if res.StatusCode >= 500 {
+			otext.Error.Set(span, true)
+			event = clientLog.Warn()
+		}
+		event = event.Int("status", res.StatusCode)
+	}
+
+	event.
+		Str("operation", operation).
+		Str("method", r.Method).
+		Str("url", url).
+		Dur("duration", duration).
+		Int("attempt", n+1).
+		Msg("http client")
+
+	return res, err
+}
+
+// idempotent requests are safe to retry
+func idempotent(r *http.Request) bool {
+	switch r.Method {
+	case "", "GET", "HEAD", "OPTIONS", "PUT", "DELETE", "TRACE":
+		return true
+	}
+	return r.Header.Get("Idempotency-Key") != ""
+}
+
+func (cfg ClientConfig) backoff(n int) time.Duration {
+	if cfg.Backoff != nil {
+		return cfg.Backoff(n)
+	}
+	d := 100 * time.Millisecond << uint(n-1)
+	if d > 3*time.Second || d <= 0 {
+		d = 3 * time.Second
+	}
+	// jitter of [d/2, d)
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+// cancelBody cancel the context of the attempt on close
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// breaker of a host: closed, open after BreakerFailures in a row, then
+// half-open after BreakerCooldown, when a single probe is let through,
+// which closes it on success, or opens it again on failure
+type breaker struct {
+	sync.Mutex
+	failures int
+	// open until, zero if closed
+	openUntil time.Time
+	probing   bool
+}
+
+func (b *breaker) allow(cfg ClientConfig) bool {
+	if cfg.BreakerFailures < 0 {
+		return true
+	}
+	b.Lock()
+	defer b.Unlock()
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *breaker) done(cfg ClientConfig, ok bool) {
+	if cfg.BreakerFailures < 0 {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+	if ok {
+		b.failures = 0
+		b.openUntil = time.Time{}
+		b.probing = false
+		return
+	}
+	b.failures++
+	if b.probing || b.failures >= cfg.BreakerFailures {
+		if b.openUntil.IsZero() || b.probing {
+			clientLog.Warn().Int("failures", b.failures).Dur("cooldown", cfg.BreakerCooldown).Msg("circuit breaker opened")
+		}
+		b.openUntil = time.Now().Add(cfg.BreakerCooldown)
+		b.probing = false
+	}
+}
+
+// release the probe without a result
+func (b *breaker) release() {
+	b.Lock()
+	b.probing = false
+	b.Unlock()
+}
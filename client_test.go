@@ -0,0 +1,136 @@
+package brick
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ot "github.com/opentracing/opentracing-go"
+	mocktracer "github.com/opentracing/opentracing-go/mocktracer"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	assert := assert.New(t)
+
+	tracer := mocktracer.New()
+	origin := ot.GlobalTracer()
+	ot.SetGlobalTracer(tracer)
+	defer ot.SetGlobalTracer(origin)
+
+	var attempts int32
+	var traced atomic.Value
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&attempts, 1)
+		traced.Store(r.Header.Get("Mockpfx-Ids-Traceid"))
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/flaky":
+			if n < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		case "/slow":
+			if n < 2 {
+				time.Sleep(100 * time.Millisecond)
+			}
+		case "/down":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(body)
+	}))
+	defer s.Close()
+
+	host := strings.TrimPrefix(s.URL, "http://")
+	c := &Client{Default: ClientConfig{
+		Retries: 2,
+		Backoff: func(n int) time.Duration { return time.Millisecond },
+	}}
+
+	// idempotent requests are retried, with the body resent
+	r, _ := http.NewRequest("PUT", s.URL+"/flaky?token=secret", strings.NewReader("hello"))
+	res, err := c.Do(context.Background(), "test.put", r)
+	assert.Nil(err)
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal("hello", string(body))
+	assert.Equal(int32(3), atomic.LoadInt32(&attempts))
+
+	// the span context is injected, and the query is not traced
+	spans := tracer.FinishedSpans()
+	assert.Len(spans, 3)
+	assert.Equal("test.put", spans[0].OperationName)
+	assert.Equal(s.URL+"/flaky", spans[0].Tag("http.url"))
+	assert.NotEmpty(traced.Load())
+
+	// others are not
+	atomic.StoreInt32(&attempts, 0)
+	r, _ = http.NewRequest("POST", s.URL+"/flaky", strings.NewReader("hello"))
+	res, err = c.Do(context.Background(), "test.post", r)
+	assert.Nil(err)
+	res.Body.Close()
+	assert.Equal(http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(int32(1), atomic.LoadInt32(&attempts))
+
+	// timeouts of attempts
+	atomic.StoreInt32(&attempts, 0)
+	c.Hosts = map[string]*ClientConfig{host: {Timeout: 20 * time.Millisecond, Retries: 1}}
+	r, _ = http.NewRequest("GET", s.URL+"/slow", nil)
+	res, err = c.Do(context.Background(), "test.slow", r)
+	assert.Nil(err)
+	res.Body.Close()
+	assert.Equal(int32(2), atomic.LoadInt32(&attempts))
+}
+
+func TestClientBreaker(t *testing.T) {
+	assert := assert.New(t)
+
+	var attempts int32
+	var healthy int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer s.Close()
+
+	c := &Client{Default: ClientConfig{BreakerFailures: 2, BreakerCooldown: 50 * time.Millisecond}}
+	get := func() (*http.Response, error) {
+		r, _ := http.NewRequest("GET", s.URL, nil)
+		res, err := c.Do(context.Background(), "test.get", r)
+		if res != nil {
+			res.Body.Close()
+		}
+		return res, err
+	}
+
+	get()
+	get()
+	_, err := get()
+	assert.Equal(ErrCircuitOpen, err)
+	assert.Equal(int32(2), atomic.LoadInt32(&attempts))
+
+	// a probe after the cooldown, which fails and opens it again
+	time.Sleep(60 * time.Millisecond)
+	res, err := get()
+	assert.Nil(err)
+	assert.Equal(http.StatusInternalServerError, res.StatusCode)
+	_, err = get()
+	assert.Equal(ErrCircuitOpen, err)
+
+	// a probe which succeeds closes it
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(60 * time.Millisecond)
+	_, err = get()
+	assert.Nil(err)
+	_, err = get()
+	assert.Nil(err)
+	assert.Equal(int32(5), atomic.LoadInt32(&attempts))
+}
@@ -0,0 +1,105 @@
+// Command graphqlgen generate typed functions of graphql operations for
+// utils.Graphql, e.g. by go:generate
+//
+//	//go:generate go run github.com/pickjunk/brick/cmd/graphqlgen -schema https://example.com/graphql -out api.go queries/*.graphql
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	req "github.com/imroc/req"
+	gen "github.com/pickjunk/brick/utils/graphqlgen"
+	ast "github.com/vektah/gqlparser/v2/ast"
+)
+
+// list is a repeatable flag
+type list []string
+
+func (l *list) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *list) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "graphqlgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	var headers, scalars list
+	schema := flag.String("schema", "", "SDL file, or url of the endpoint to introspect")
+	out := flag.String("out", "", "output file, stdout if empty")
+	pkg := flag.String("package", "", "package name, the name of the directory of -out by default")
+	flag.Var(&headers, "header", "header of introspection, e.g. \"Authorization: Bearer xxx\", repeatable")
+	flag.Var(&scalars, "scalar", "Go type of a custom scalar, e.g. Time=time.Time, repeatable")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: graphqlgen -schema schema.graphql|url [flags] operations.graphql...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *schema == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	h := req.Header{}
+	for _, v := range headers {
+		kv := strings.SplitN(v, ":", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid header %q", v)
+		}
+		h[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+
+	cfg := &gen.Config{Package: *pkg, Scalars: map[string]string{}}
+	for _, v := range scalars {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid scalar %q", v)
+		}
+		cfg.Scalars[kv[0]] = kv[1]
+	}
+	if cfg.Package == "" {
+		dir, err := filepath.Abs(filepath.Dir(*out))
+		if err != nil {
+			return err
+		}
+		cfg.Package = filepath.Base(dir)
+	}
+
+	sdl, err := gen.LoadSchema(context.Background(), *schema, h)
+	if err != nil {
+		return err
+	}
+	cfg.Schema = sdl
+
+	for _, file := range flag.Args() {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		cfg.Operations = append(cfg.Operations, &ast.Source{Name: file, Input: string(data)})
+	}
+
+	src, err := gen.Generate(cfg)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(*out, src, 0644)
+}
@@ -6,6 +6,7 @@ import (
 
 	dbr "github.com/gocraft/dbr/opentracing"
 	bl "github.com/pickjunk/brick/log"
+	bm "github.com/pickjunk/brick/metrics"
 )
 
 // Logger for dbr
@@ -52,11 +53,14 @@ func (l *Logger) EventErrKv(eventName string, err error, kvs map[string]string)
 
 // Timing func
 func (l *Logger) Timing(eventName string, nanoseconds int64) {
+	bm.DBDuration.WithLabelValues(eventName).Observe(float64(nanoseconds) / 1e9)
 	l.Info().Dur("duration", time.Duration(nanoseconds)*time.Nanosecond).Msg(eventName)
 }
 
 // TimingKv func
 func (l *Logger) TimingKv(eventName string, nanoseconds int64, kvs map[string]string) {
+	bm.DBDuration.WithLabelValues(eventName).Observe(float64(nanoseconds) / 1e9)
+
 	info := l.Info()
 	for k, v := range kvs {
 		info = info.Str(k, v)
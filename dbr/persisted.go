@@ -0,0 +1,58 @@
+package dbr
+
+import (
+	"context"
+
+	dbr "github.com/gocraft/dbr"
+	b "github.com/pickjunk/brick"
+)
+
+var _ b.PersistedQueryStore = (*PersistedQueryStore)(nil)
+
+// PersistedQueryStore store persisted queries of graphql in MySQL,
+// it implements brick.PersistedQueryStore. The table is like:
+//
+//	CREATE TABLE persisted_queries (
+//	  hash CHAR(64) NOT NULL PRIMARY KEY,
+//	  query MEDIUMTEXT NOT NULL,
+//	  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+//	)
+type PersistedQueryStore struct {
+	db    *DB
+	table string
+}
+
+// NewPersistedQueryStore create a PersistedQueryStore on table,
+// "persisted_queries" if table is empty
+func NewPersistedQueryStore(db *DB, table string) *PersistedQueryStore {
+	if table == "" {
+		table = "persisted_queries"
+	}
+	return &PersistedQueryStore{db, table}
+}
+
+// Get query by hash
+func (s *PersistedQueryStore) Get(ctx context.Context, hash string) (string, bool, error) {
+	var query string
+	err := s.db.Select("query").
+		From(s.table).
+		Where("hash = ?", hash).
+		LoadOneContext(ctx, &query)
+	if err == dbr.ErrNotFound {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return query, true, nil
+}
+
+// Set query by hash, existing ones are kept
+func (s *PersistedQueryStore) Set(ctx context.Context, hash, query string) error {
+	_, err := s.db.InsertBySql(
+		"INSERT IGNORE INTO "+s.table+" (hash, query) VALUES (?, ?)",
+		hash,
+		query,
+	).ExecContext(ctx)
+	return err
+}
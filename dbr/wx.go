@@ -0,0 +1,75 @@
+package dbr
+
+import (
+	"context"
+	"time"
+
+	dbr "github.com/gocraft/dbr"
+	utils "github.com/pickjunk/brick/utils"
+)
+
+var _ utils.WxTokenStore = (*WxTokenStore)(nil)
+
+// WxTokenStore store tokens of wx in MySQL, shared between replicas,
+// it implements utils.WxTokenStore. It does not lock tokens across
+// replicas, see utils.WxTokenStore. The table is like:
+//
+//	CREATE TABLE wx_tokens (
+//	  name VARCHAR(191) NOT NULL PRIMARY KEY,
+//	  token VARCHAR(1024) NOT NULL,
+//	  expires_at BIGINT NOT NULL DEFAULT 0,
+//	  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+//	)
+type WxTokenStore struct {
+	db    *DB
+	table string
+}
+
+// NewWxTokenStore create a WxTokenStore on table,
+// "wx_tokens" if table is empty
+func NewWxTokenStore(db *DB, table string) *WxTokenStore {
+	if table == "" {
+		table = "wx_tokens"
+	}
+	return &WxTokenStore{db, table}
+}
+
+// Get token by key
+func (s *WxTokenStore) Get(ctx context.Context, key string) (*utils.WxToken, error) {
+	var row struct {
+		Token     string
+		ExpiresAt int64
+	}
+	err := s.db.Select("token", "expires_at").
+		From(s.table).
+		Where("name = ?", key).
+		LoadOneContext(ctx, &row)
+	if err == dbr.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	t := &utils.WxToken{Token: row.Token}
+	if row.ExpiresAt > 0 {
+		t.ExpiresAt = time.Unix(row.ExpiresAt, 0)
+	}
+	return t, nil
+}
+
+// Set token by key, existing ones are replaced
+func (s *WxTokenStore) Set(ctx context.Context, key string, token *utils.WxToken) error {
+	var expiresAt int64
+	if !token.ExpiresAt.IsZero() {
+		expiresAt = token.ExpiresAt.Unix()
+	}
+	_, err := s.db.InsertBySql(
+		"INSERT INTO "+s.table+" (name, token, expires_at) VALUES (?, ?, ?)"+
+			" ON DUPLICATE KEY UPDATE token = VALUES(token), expires_at = VALUES(expires_at)",
+		key,
+		token.Token,
+		expiresAt,
+	).ExecContext(ctx)
+	return err
+}
@@ -1,17 +1,31 @@
 package error
 
 import (
-	"fmt"
+	"bytes"
+	"encoding/json"
 )
 
 // BusinessError struct
 type BusinessError struct {
-	Code int
-	Msg  string
+	Code int    `json:"code" xml:"code"`
+	Msg  string `json:"msg" xml:"msg"`
 }
 
+// Error is the JSON of e, e.g. {"code":10001,"msg":"..."}
 func (e BusinessError) Error() string {
-	return fmt.Sprintf(`{"code":%d,"msg":"%s"}`, e.Code, e.Msg)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(e)
+	return string(bytes.TrimSpace(buf.Bytes()))
+}
+
+// Extensions of the graphql error, see
+// github.com/graph-gophers/graphql-go/errors.QueryError
+func (e BusinessError) Extensions() map[string]interface{} {
+	return map[string]interface{}{
+		"code": e.Code,
+	}
 }
 
 // Throw a BusinessError with panic
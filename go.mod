@@ -1,31 +1,69 @@
 module github.com/pickjunk/brick
 
 require (
-	github.com/DATA-DOG/go-sqlmock v1.3.2 // indirect
-	github.com/codahale/hdrhistogram v0.0.0-20161010025455-3a0bb77429bd // indirect
-	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/gabriel-vasile/mimetype v1.0.1
 	github.com/go-mail/mail v2.3.1+incompatible
 	github.com/go-sql-driver/mysql v1.4.1
 	github.com/gocraft/dbr v0.0.0-20190131145710-48a049970bd2
+	github.com/gorilla/websocket v1.5.3
 	github.com/graph-gophers/graphql-go v0.0.0-20190214043811-70e684c13100
 	github.com/imroc/req v0.2.4
-	github.com/jmoiron/sqlx v1.2.0 // indirect
-	github.com/julienschmidt/httprouter v1.2.0
-	github.com/mattn/go-sqlite3 v1.10.0 // indirect
-	github.com/opentracing/opentracing-go v1.0.2
+	github.com/julienschmidt/httprouter v1.3.0
+	github.com/opentracing/opentracing-go v1.2.0
+	github.com/prometheus/client_golang v1.23.2
 	github.com/rs/cors v1.6.0
 	github.com/rs/zerolog v1.16.0
 	github.com/satori/go.uuid v1.2.0
-	github.com/stretchr/testify v1.3.0
-	github.com/uber-go/atomic v1.3.2 // indirect
+	github.com/stretchr/testify v1.12.1
 	github.com/uber/jaeger-client-go v2.15.1-0.20190214182810-64f57863bf63+incompatible
+	github.com/vektah/gqlparser/v2 v2.5.59
+	go.opentelemetry.io/contrib/propagators/b3 v1.36.0
+	go.opentelemetry.io/contrib/propagators/jaeger v1.36.0
+	go.opentelemetry.io/otel v1.36.0
+	go.opentelemetry.io/otel/bridge/opentracing v1.36.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.36.0
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.36.0
+	go.opentelemetry.io/otel/sdk v1.36.0
+	go.opentelemetry.io/otel/trace v1.36.0
+	go.yaml.in/yaml/v3 v3.0.5
+)
+
+require (
+	github.com/DATA-DOG/go-sqlmock v1.3.2 // indirect
+	github.com/agnivade/levenshtein v1.2.1 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cenkalti/backoff/v5 v5.0.2 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/codahale/hdrhistogram v0.0.0-20161010025455-3a0bb77429bd // indirect
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/grpc-ecosystem/grpc-gateway/v2 v2.26.3 // indirect
+	github.com/jmoiron/sqlx v1.2.0 // indirect
+	github.com/lib/pq v1.0.0 // indirect
+	github.com/mattn/go-sqlite3 v1.14.16 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/pkg/errors v0.8.1 // indirect
+	github.com/prometheus/client_model v0.6.2 // indirect
+	github.com/prometheus/common v0.66.1 // indirect
+	github.com/prometheus/procfs v0.16.1 // indirect
+	github.com/uber-go/atomic v1.3.2 // indirect
 	github.com/uber/jaeger-lib v2.0.1-0.20190122222657-d036253de8f5+incompatible // indirect
-	go.uber.org/atomic v1.3.2 // indirect
+	go.opentelemetry.io/auto/sdk v1.1.0 // indirect
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace v1.36.0 // indirect
+	go.opentelemetry.io/otel/metric v1.36.0 // indirect
+	go.opentelemetry.io/proto/otlp v1.6.0 // indirect
+	go.yaml.in/yaml/v2 v2.4.2 // indirect
+	golang.org/x/net v0.43.0 // indirect
+	golang.org/x/sys v0.35.0 // indirect
+	golang.org/x/text v0.28.0 // indirect
 	google.golang.org/appengine v1.4.0 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20250519155744-55703ea1f237 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250519155744-55703ea1f237 // indirect
+	google.golang.org/grpc v1.72.1 // indirect
+	google.golang.org/protobuf v1.36.8 // indirect
 	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
-	gopkg.in/check.v1 v0.0.0-20161208181325-20d25e280405 // indirect
 	gopkg.in/mail.v2 v2.3.1 // indirect
 )
 
-go 1.13
+go 1.25.0
@@ -2,16 +2,31 @@ package brick
 
 import (
 	"context"
-	"regexp"
-	"strings"
+	"fmt"
+	"path/filepath"
+	"runtime"
 
 	graphql "github.com/graph-gophers/graphql-go"
+	ast "github.com/vektah/gqlparser/v2/ast"
 )
 
 // Graphql struct
 type Graphql struct {
+	// sources of Schema calls, and the composed SDL of them
+	sources  []*ast.Source
 	schema   string
 	resolver interface{}
+	// nil if persisted queries are disabled
+	persisted     *PersistedQueryConfig
+	subscriptions *SubscriptionConfig
+	batch         *BatchConfig
+	limits        *LimitConfig
+	// nil if the playground is disabled
+	playground *PlaygroundConfig
+	// nil if tracing of resolvers is disabled
+	tracing *TracingConfig
+	// business errors as {"code":...,"msg":...} in messages
+	legacyErrors bool
 }
 
 type graphqlLogger struct{}
@@ -21,97 +36,85 @@ func (l *graphqlLogger) LogPanic(_ context.Context, value interface{}) {
 	// log panic error in relay.go, should not log here
 }
 
-// Graphql create a graphql endpoint
+// graphqlEndpoint is a Graphql served on a Router
+type graphqlEndpoint struct {
+	*Graphql
+	schema *graphql.Schema
+	// canceled when the server starts shutdown, to end subscriptions
+	closing context.Context
+	costs   *costSchema
+	// operation labels of metrics
+	operations *operationLabels
+}
+
+// Graphql create a graphql endpoint, subscriptions are served over
+// WebSocket (graphql-transport-ws) and Server-Sent Events on the same path
 func (r *Router) Graphql(path string, g *Graphql) *Router {
 	schema := graphql.MustParseSchema(
 		g.schema,
 		g.resolver,
 		graphql.Logger(&graphqlLogger{}),
+		graphql.UseStringDescriptions(),
+		graphql.Tracer(newGraphqlTracer(g.tracing)),
 	)
 
-	r.GET(path, func(ctx context.Context) {
-		relay(ctx, schema)
-	})
-	r.POST(path, func(ctx context.Context) {
-		relay(ctx, schema)
-	})
+	closing, cancel := context.WithCancel(context.Background())
+	r.onClose(cancel)
+
+	e := &graphqlEndpoint{g, schema, closing, newCostSchema(g.schema), &operationLabels{}}
+	r.GET(path, e.relay)
+	r.POST(path, e.relay)
+
+	r.routes.Lock()
+	r.routes.graphqls[r.prefix+path] = e
+	r.routes.Unlock()
 
 	return r
 }
 
 // NewGraphql create a Graphql struct
 func NewGraphql(resolver interface{}) *Graphql {
-	return &Graphql{
-		schema: `
-		schema {
-			query: Query
-			mutation: Mutation
-		}
-
-		type Query {}
-		type Mutation {}
-		`,
-		resolver: resolver,
+	g := &Graphql{
+		resolver:      resolver,
+		subscriptions: &SubscriptionConfig{},
+		batch:         &BatchConfig{MaxSize: 10, Concurrency: 4},
+		limits:        &LimitConfig{},
+		playground:    &PlaygroundConfig{},
 	}
+	g.sources = []*ast.Source{{Name: "brick", Input: costDirective}}
+	g.schema = costDirective + "\n"
+	return g
 }
 
-func (g *Graphql) replaceFunc(re *regexp.Regexp, str string, repl func([]string) string) string {
-	result := ""
-	lastIndex := 0
-
-	for _, v := range re.FindAllSubmatchIndex([]byte(str), -1) {
-		groups := []string{}
-		for i := 0; i < len(v); i += 2 {
-			groups = append(groups, str[v[i]:v[i+1]])
-		}
-
-		result += str[lastIndex:v[0]] + repl(groups)
-		lastIndex = v[1]
-	}
-
-	return result + str[lastIndex:]
+// LegacyErrors keep the message of business errors as
+// {"code":...,"msg":...}, for clients which parse it, the code is in
+// extensions either way
+func (g *Graphql) LegacyErrors(legacy bool) *Graphql {
+	g.legacyErrors = legacy
+	return g
 }
 
-// Schema define graphql schema
+// Schema define graphql schema, sources of all calls are composed:
+// types of the same name are merged, extend type is applied, and
+// conflicting definitions panic with the file and line of both calls
 func (g *Graphql) Schema(s string) {
-	a := g.schema
-	b := s
-
-	r := regexp.MustCompile("(?s)type Query {(.*?)}")
-	var query []string
-	a = g.replaceFunc(r, a, func(m []string) string {
-		lines := strings.Split(strings.Replace(m[1], " ", "", -1), "\n")
-		query = append(query, lines...)
-		return ""
-	})
-	b = g.replaceFunc(r, b, func(m []string) string {
-		lines := strings.Split(strings.Replace(m[1], " ", "", -1), "\n")
-		query = append(query, lines...)
-		return ""
-	})
-
-	r = regexp.MustCompile("(?s)type Mutation {(.*?)}")
-	var mutation []string
-	a = g.replaceFunc(r, a, func(m []string) string {
-		lines := strings.Split(strings.Replace(m[1], " ", "", -1), "\n")
-		mutation = append(mutation, lines...)
-		return ""
-	})
-	b = g.replaceFunc(r, b, func(m []string) string {
-		lines := strings.Split(strings.Replace(m[1], " ", "", -1), "\n")
-		mutation = append(mutation, lines...)
-		return ""
-	})
-
-	result := ""
-	if len(query) > 0 {
-		result += "type Query {\n" + strings.Join(query, "\n") + "\n}\n"
+	name := "schema"
+	if _, file, line, ok := runtime.Caller(1); ok {
+		// e.g. user/schema.go:12, which tells the module
+		name = fmt.Sprintf("%s/%s:%d", filepath.Base(filepath.Dir(file)), filepath.Base(file), line)
 	}
-	if len(mutation) > 0 {
-		result += "type Mutation {\n" + strings.Join(mutation, "\n") + "\n}\n"
+
+	sources := append(g.sources, &ast.Source{Name: name, Input: s})
+	doc, err := composeSchema(sources)
+	if err != nil {
+		log.Panic().Err(err).Msg("graphql schema")
 	}
-	result += strings.Trim(a, "\n ") + "\n" + strings.Trim(b, "\n ")
-	result = strings.Trim(result, "\n ")
 
-	g.schema = result
+	g.sources = sources
+	g.schema = printSchema(doc)
+}
+
+// SDL return the composed schema, as it is served
+func (g *Graphql) SDL() string {
+	return g.schema
 }
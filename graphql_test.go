@@ -2,79 +2,191 @@ package brick
 
 import (
 	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+	ast "github.com/vektah/gqlparser/v2/ast"
 )
 
 func TestSchema(t *testing.T) {
-	g := &Graphql{
-		schema: "type Query {a(b:B): A} type Mutation {a(b:B): A} type A {ab: ID}",
-	}
-	g.Schema("type Query {B(a:A): B} type Mutation {a(b:B): A} type B {ab: String}")
+	assert := assert.New(t)
 
-	if g.schema != `type Query {
-a(b:B):A
-B(a:A):B
+	g := &Graphql{}
+	g.Schema("type Query {a(b:B): A} type Mutation {a(b:B): A} type A {ab: ID}")
+	g.Schema("type Query {B(a:A): B} type Mutation {a(b: B): A} type B {ab: String}")
+	assert.Equal(`schema {
+  query: Query
+  mutation: Mutation
+}
+type Query {
+  a(b: B): A
+  B(a: A): B
 }
 type Mutation {
-a(b:B):A
-a(b:B):A
+  a(b: B): A
 }
-type A {ab: ID}
-type B {ab: String}` {
-		t.Error(g.schema)
-		t.Error("Schema fail")
-	}
-
-	g = &Graphql{
-		schema: "type Mutation {a(b:B): A}",
-	}
-	g.Schema("type Query {B(a:A): B}")
+type A {
+  ab: ID
+}
+type B {
+  ab: String
+}
+`, g.SDL())
 
-	if g.schema != `type Query {
-B(a:A):B
+	// empty roots, subscriptions and extensions of types from other sources
+	g = &Graphql{}
+	g.Schema("type Query {} type Mutation {a: A} type A {ab: ID}")
+	g.Schema("extend type A {cd: Int} type Subscription {a: A}")
+	assert.Equal(`schema {
+  mutation: Mutation
+  subscription: Subscription
 }
 type Mutation {
-a(b:B):A
-}` {
-		t.Error(g.schema)
-		t.Error("Schema fail")
+  a: A
+}
+type A {
+  ab: ID
+  cd: Int
+}
+type Subscription {
+  a: A
+}
+`, g.SDL())
+
+	// empty types extended by other sources, and empty objects of default values
+	g = &Graphql{}
+	g.Schema(`
+	# type A {}
+	type Query {}
+	input In {
+		a: Int
+	}
+	`)
+	g.Schema(`extend type Query {
+		"type B {}"
+		a(in: In = {}): Int
 	}
+	extend type Query {}`)
+	assert.Equal(`schema {
+  query: Query
+}
+type Query {
+  """
+  type B {}
+  """
+  a(in: In = {}): Int
+}
+input In {
+  a: Int
+}
+`, g.SDL())
 
-	g = &Graphql{
-		schema: "",
+	// descriptions, directives, and braces in default values and descriptions
+	g = NewGraphql(nil)
+	g.Schema(`
+	"""
+	root {query}
+	"""
+	type Query {
+		"list {of} users"
+		users(filter: String = "{}", first: Int = 10): [User!]! @cost(value: 2, multiplier: "first")
+	}
+	type User {
+		id: ID!
+	}
+	`)
+	g.Schema(`
+	interface Node {
+		id: ID!
+	}
+	extend type User implements Node {
+		name: String
 	}
-	g.Schema("type Query {B(a:A): B} type Mutation {a(b:B): A}")
+	`)
+	assert.Equal(`schema {
+  query: Query
+}
+directive @cost(value: Int!, multiplier: String) on FIELD_DEFINITION
+"""
+root {query}
+"""
+type Query {
+  """
+  list {of} users
+  """
+  users(filter: String = "{}", first: Int = 10): [User!]! @cost(value: 2, multiplier: "first")
+}
+type User implements Node {
+  id: ID!
+  name: String
+}
+interface Node {
+  id: ID!
+}
+`, g.SDL())
 
-	if g.schema != `type Query {
-B(a:A):B
+	// inputs and enums split across modules
+	g = &Graphql{}
+	g.Schema("type Query {a(in: In): E} input In {a: Int} enum E {A B}")
+	g.Schema("input In {b: Int} enum E {B C}")
+	assert.Equal(`schema {
+  query: Query
+}
+type Query {
+  a(in: In): E
+}
+input In {
+  a: Int
+  b: Int
+}
+enum E {
+  A
+  B
+  C
+}
+`, g.SDL())
 }
-type Mutation {
-a(b:B):A
-}` {
-		t.Error(g.schema)
-		t.Error("Schema fail")
-	}
 
-	g = &Graphql{
-		schema: "",
-	}
-	g.Schema("type Mutation {a(b:B): A}")
+func TestSchemaConflict(t *testing.T) {
+	assert := assert.New(t)
 
-	if g.schema != `type Mutation {
-a(b:B):A
-}` {
-		t.Error(g.schema)
-		t.Error("Schema fail")
-	}
+	g := &Graphql{}
+	g.Schema("type Query {a(b: Int): String}")
+	assert.PanicsWithValue(
+		"graphql schema",
+		func() { g.Schema("type Query {\n a(b: String): String\n}") },
+	)
+	// the schema is unchanged after a conflict
+	assert.Equal("schema {\n  query: Query\n}\ntype Query {\n  a(b: Int): String\n}\n", g.SDL())
 
-	g = &Graphql{
-		schema: "type Mutation {a(b:B): A}",
-	}
-	g.Schema("")
+	_, err := composeSchema(g.sources)
+	assert.Nil(err)
 
-	if g.schema != `type Mutation {
-a(b:B):A
-}` {
-		t.Error(g.schema)
-		t.Error("Schema fail")
-	}
+	g.sources = append(g.sources, &ast.Source{Name: "user/schema.go:7", Input: "type Query {\n a(b: String): String\n}"})
+	_, err = composeSchema(g.sources)
+	assert.Regexp(`^field Query\.a: a\(b: String\): String \(user/schema\.go:7, line 2\) conflicts with a\(b: Int\): String \(\w+/graphql_test\.go:\d+, line 1\)$`, err.Error())
+
+	_, err = composeSchema([]*ast.Source{
+		{Name: "a", Input: "type Query {a: A} type A {a: Int}"},
+		{Name: "b", Input: "input A {a: Int}"},
+	})
+	assert.EqualError(err, "type A is INPUT_OBJECT (b, line 1), but OBJECT in a, line 1")
+
+	_, err = composeSchema([]*ast.Source{
+		{Name: "a", Input: "type Query {a: Int}"},
+		{Name: "b", Input: "extend type A {a: Int}"},
+	})
+	assert.EqualError(err, "extend type A (b, line 1): type A is not defined")
+
+	_, err = composeSchema([]*ast.Source{
+		{Name: "a", Input: `type Query {a(n: Int): [Int] @cost(value: 2, multiplier: "n")}`},
+		{Name: "b", Input: `type Query {a(n: Int): [Int] @cost(value: 1, multiplier: "n")}`},
+		{Name: "c", Input: costDirective},
+	})
+	assert.EqualError(err, `field Query.a: a(n: Int): [Int] @cost(value: 1, multiplier: "n") (b, line 1) conflicts with a(n: Int): [Int] @cost(value: 2, multiplier: "n") (a, line 1)`)
+
+	_, err = composeSchema([]*ast.Source{
+		{Name: "a", Input: `type Query {a: Int @deprecated}`},
+		{Name: "b", Input: `type Query {a: Int @deprecated}`},
+	})
+	assert.Nil(err)
 }
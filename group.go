@@ -0,0 +1,127 @@
+package brick
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Group create a sub router with prefix, middlewares registered by
+// the sub router inside fn are isolated from r and its other groups
+func (r *Router) Group(prefix string, fn func(g *Router)) *Router {
+	fn(r.Prefix(prefix).Middlewares())
+	return r
+}
+
+// methods served by a mounted http.Handler
+var mountMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
+// Mount compose a *Router or an http.Handler under prefix.
+//
+// For a *Router, every route registered on it so far is registered on r
+// with prefix, keeping its own middlewares and CORS, after the middlewares
+// of r. OnStart and OnShutdown hooks of it are appended to r as well.
+// Routes registered on it after Mount are not served.
+//
+// For an http.Handler, all requests under prefix are passed to it,
+// with prefix stripped from the url path, also when r is mounted again.
+func (r *Router) Mount(prefix string, h interface{}) *Router {
+	switch sub := h.(type) {
+	case *Router:
+		m := r.Prefix(prefix)
+		for _, reg := range sub.routes.all() {
+			mr := m
+			if mr.cors == nil && reg.cors != nil {
+				mr = mr.CORS(reg.cors)
+			}
+
+			args := make([]interface{}, 0, len(reg.middlewares)+1)
+			for _, middleware := range reg.middlewares {
+				args = append(args, middleware)
+			}
+			if reg.typed != nil {
+				args = append(args, reg.typed)
+			} else {
+				args = append(args, reg.handle)
+			}
+
+			mr.handle(reg.method, reg.path, reg.handler, reg.source, args)
+		}
+
+		sub.routes.Lock()
+		graphqls := make(map[string]*graphqlEndpoint, len(sub.routes.graphqls))
+		for path, e := range sub.routes.graphqls {
+			graphqls[m.prefix+path] = e
+		}
+		sub.routes.Unlock()
+		r.routes.Lock()
+		for path, e := range graphqls {
+			r.routes.graphqls[path] = e
+		}
+		r.routes.Unlock()
+
+		if sub.lifecycle != r.lifecycle {
+			sub.lifecycle.Lock()
+			onStart := sub.lifecycle.onStart
+			onShutdown := sub.lifecycle.onShutdown
+			onClose := sub.lifecycle.onClose
+			sub.lifecycle.Unlock()
+
+			for _, hook := range onStart {
+				r.OnStart(hook)
+			}
+			for _, hook := range onShutdown {
+				r.OnShutdown(hook)
+			}
+			for _, f := range onClose {
+				r.onClose(f)
+			}
+		}
+	case http.Handler:
+		m := r.Prefix(strings.TrimRight(prefix, "/"))
+		// the prefix is stripped by the catch-all param at request time,
+		// which still holds when r is mounted into another router
+		handler := Handle(func(ctx context.Context) {
+			req := Request(ctx)
+			r2 := new(http.Request)
+			*r2 = *req
+			r2.URL = new(url.URL)
+			*r2.URL = *req.URL
+			r2.URL.Path, r2.URL.RawPath = mountPath(req.URL, Param(ctx, "brick_mount"))
+			sub.ServeHTTP(Response(ctx), r2)
+		})
+		name := handlerName(sub)
+		source := caller()
+		for _, method := range mountMethods {
+			if method == "OPTIONS" && m.cors != nil {
+				// CORS preflight is registered by other methods
+				continue
+			}
+			m.handle(method, "/*brick_mount", name, source, []interface{}{handler})
+		}
+	default:
+		log.Panic().Msgf("expect *brick.Router or http.Handler, but get %T", h)
+	}
+
+	return r
+}
+
+// mountPath return the path and raw path of u with everything
+// before rest stripped, rest is the catch-all param of a mount
+func mountPath(u *url.URL, rest string) (string, string) {
+	if u.RawPath == "" {
+		return rest, ""
+	}
+
+	// keep the escaping of the original path
+	for i := 0; i < len(u.RawPath); i++ {
+		if u.RawPath[i] != '/' {
+			continue
+		}
+		if p, err := url.PathUnescape(u.RawPath[i:]); err == nil && p == rest {
+			return rest, u.RawPath[i:]
+		}
+	}
+	return rest, ""
+}
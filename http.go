@@ -33,3 +33,9 @@ func Params(ctx context.Context) httprouter.Params {
 func Param(ctx context.Context, key string) string {
 	return value(ctx, "http").(*HTTP).Params.ByName(key)
 }
+
+// Route get the route pattern (with prefix) from context, e.g. /user/:id
+func Route(ctx context.Context) string {
+	route, _ := value(ctx, "route").(string)
+	return route
+}
@@ -5,6 +5,7 @@ import (
 
 	opentracing "github.com/opentracing/opentracing-go"
 	config "github.com/uber/jaeger-client-go/config"
+	zipkin "github.com/uber/jaeger-client-go/zipkin"
 )
 
 type jaegerLogger struct{}
@@ -18,9 +19,19 @@ func (l *jaegerLogger) Infof(msg string, args ...interface{}) {
 	log.Debug().Str("component", "brick.jaeger").Msgf(msg, args...)
 }
 
-// Jaeger setup a jaeger tracer
+// Jaeger setup a jaeger tracer, which extracts and injects
+// W3C Trace Context and Zipkin B3 headers besides jaeger's own
 func Jaeger(cfg *config.Configuration) io.Closer {
-	tracer, closer, err := cfg.NewTracer(config.Logger(&jaegerLogger{}))
+	b3 := zipkin.NewZipkinB3HTTPHeaderPropagator()
+	w3c := traceContextPropagator{}
+
+	tracer, closer, err := cfg.NewTracer(
+		config.Logger(&jaegerLogger{}),
+		config.Injector(B3HTTPHeaders, b3),
+		config.Extractor(B3HTTPHeaders, b3),
+		config.Injector(TraceContextHTTPHeaders, w3c),
+		config.Extractor(TraceContextHTTPHeaders, w3c),
+	)
 	if err != nil {
 		log.Panic().Err(err).Send()
 	}
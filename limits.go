@@ -0,0 +1,429 @@
+package brick
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	ast "github.com/vektah/gqlparser/v2/ast"
+	parser "github.com/vektah/gqlparser/v2/parser"
+)
+
+// LimitConfig protections against expensive queries, zero is unlimited,
+// except MaxRequestBytes
+type LimitConfig struct {
+	// MaxRequestBytes of the body of POST requests, the url query of GET
+	// requests and WebSocket messages, 1MB if zero, -1 for unlimited
+	MaxRequestBytes int64
+	// MaxBytes of the query text
+	MaxBytes int
+	// MaxDepth of nested fields, root fields are of depth 1
+	MaxDepth int
+	// MaxAliases in the operation, fragments included
+	MaxAliases int
+	// MaxRootFields of the operation
+	MaxRootFields int
+	// MaxComplexity of the operation, every field costs 1, unless it is
+	// annotated by @cost(value: n) in the schema. With
+	// @cost(value: n, multiplier: "first"), the cost of its selections
+	// is multiplied by the argument named first
+	MaxComplexity int
+	// Timeout of execution, subscriptions excluded
+	Timeout time.Duration
+}
+
+// directive of cost annotations, declared in the schema of NewGraphql
+const costDirective = `directive @cost(value: Int!, multiplier: String) on FIELD_DEFINITION`
+
+// default of LimitConfig.MaxRequestBytes
+const defaultMaxRequestBytes = 1 << 20
+
+// Limits config protections against expensive queries,
+// rejected queries are responded with errors of extensions.code
+// QUERY_TOO_LARGE, QUERY_TOO_DEEP, TOO_MANY_ALIASES,
+// TOO_MANY_ROOT_FIELDS or QUERY_TOO_COMPLEX, and the code is added to the
+// access log as rejected
+func (g *Graphql) Limits(cfg *LimitConfig) *Graphql {
+	c := *cfg
+	g.limits = &c
+	return g
+}
+
+// fieldCost of a field definition
+type fieldCost struct {
+	// named type of the field
+	typ        string
+	cost       int
+	multiplier string
+	// default value of the multiplier argument, 0 if none
+	multiplierDefault int
+}
+
+// costSchema is the type information for query analysis
+type costSchema struct {
+	// fields by type name, then field name
+	types map[string]map[string]fieldCost
+	// root types by operation
+	roots map[ast.Operation]string
+}
+
+func newCostSchema(sdl string) *costSchema {
+	s := &costSchema{
+		types: make(map[string]map[string]fieldCost),
+		roots: map[ast.Operation]string{
+			ast.Query:        "Query",
+			ast.Mutation:     "Mutation",
+			ast.Subscription: "Subscription",
+		},
+	}
+
+	doc, err := parser.ParseSchema(&ast.Source{Input: sdl})
+	if err != nil {
+		// graphql-go accepts it but gqlparser does not,
+		// analyze with default costs
+		log.Warn().Err(err).Msg("graphql limits: parse schema")
+		return s
+	}
+
+	for _, def := range doc.Schema {
+		for _, op := range def.OperationTypes {
+			s.roots[op.Operation] = op.Type
+		}
+	}
+
+	defs := append(ast.DefinitionList{}, doc.Definitions...)
+	defs = append(defs, doc.Extensions...)
+	for _, def := range defs {
+		fields := s.types[def.Name]
+		if fields == nil {
+			fields = make(map[string]fieldCost)
+			s.types[def.Name] = fields
+		}
+		for _, f := range def.Fields {
+			fc := fieldCost{typ: f.Type.Name(), cost: 1}
+			if d := f.Directives.ForName("cost"); d != nil {
+				if arg := d.Arguments.ForName("value"); arg != nil {
+					if n, err := strconv.Atoi(arg.Value.Raw); err == nil && n >= 0 {
+						fc.cost = n
+					}
+				}
+				if arg := d.Arguments.ForName("multiplier"); arg != nil {
+					fc.multiplier = arg.Value.Raw
+					if def := f.Arguments.ForName(fc.multiplier); def != nil {
+						fc.multiplierDefault, _ = intValue(def.DefaultValue, nil)
+					}
+				}
+			}
+			fields[f.Name] = fc
+		}
+	}
+
+	return s
+}
+
+// defaultMultiplier is the multiplier when the argument has no value
+func (fc fieldCost) defaultMultiplier() int {
+	if fc.multiplierDefault > 0 {
+		return fc.multiplierDefault
+	}
+	return 1
+}
+
+func (s *costSchema) field(typ, name string) fieldCost {
+	if fc, ok := s.types[typ][name]; ok {
+		return fc
+	}
+	return fieldCost{cost: 1}
+}
+
+// analysis of an operation
+type analysis struct {
+	schema    *costSchema
+	doc       *ast.QueryDocument
+	op        *ast.OperationDefinition
+	variables map[string]interface{}
+	limits    *LimitConfig
+
+	aliases int
+	// fragments being visited, against cycles
+	visiting map[string]bool
+	// results of fragments visited, by name
+	fragments map[string]fragmentAnalysis
+	// root fields of fragments visited, by name
+	fragmentRoots map[string]int
+}
+
+// fragmentAnalysis is the analysis of a fragment, of depth 1
+type fragmentAnalysis struct {
+	cost, depth, aliases int
+}
+
+// addCost add costs, or counts, saturated at math.MaxInt
+func addCost(a, b int) int {
+	if a > math.MaxInt-b {
+		return math.MaxInt
+	}
+	return a + b
+}
+
+// mulCost multiply costs, saturated at math.MaxInt
+func mulCost(a, b int) int {
+	if a != 0 && b > math.MaxInt/a {
+		return math.MaxInt
+	}
+	return a * b
+}
+
+// exceeded return true if the limits of cost, depth or aliases are
+// exceeded, the analysis stops then
+func (a *analysis) exceeded(cost, depth int) bool {
+	l := a.limits
+	return l.MaxComplexity > 0 && cost > l.MaxComplexity ||
+		l.MaxDepth > 0 && depth > l.MaxDepth ||
+		l.MaxAliases > 0 && a.aliases > l.MaxAliases
+}
+
+// selectionSet return the cost, and the max depth of fields in set,
+// which are of depth
+func (a *analysis) selectionSet(set ast.SelectionSet, typ string, depth int) (int, int) {
+	cost, maxDepth := 0, 0
+	for _, sel := range set {
+		var c, d int
+		switch s := sel.(type) {
+		case *ast.Field:
+			if s.Alias != "" && s.Alias != s.Name {
+				a.aliases = addCost(a.aliases, 1)
+			}
+			d = depth
+			if s.Name == "__typename" {
+				break
+			}
+			fc := a.schema.field(typ, s.Name)
+			childCost, childDepth := a.selectionSet(s.SelectionSet, fc.typ, depth+1)
+			if fc.multiplier != "" {
+				childCost = mulCost(childCost, a.multiplier(s, fc))
+			}
+			c = addCost(fc.cost, childCost)
+			if childDepth > d {
+				d = childDepth
+			}
+		case *ast.InlineFragment:
+			t := typ
+			if s.TypeCondition != "" {
+				t = s.TypeCondition
+			}
+			c, d = a.selectionSet(s.SelectionSet, t, depth)
+		case *ast.FragmentSpread:
+			fa, ok := a.fragment(s.Name)
+			if !ok {
+				continue
+			}
+			a.aliases = addCost(a.aliases, fa.aliases)
+			c = fa.cost
+			if fa.depth > 0 {
+				d = fa.depth + depth - 1
+			}
+		}
+		cost = addCost(cost, c)
+		if d > maxDepth {
+			maxDepth = d
+		}
+		if a.exceeded(cost, maxDepth) {
+			break
+		}
+	}
+	return cost, maxDepth
+}
+
+// fragment analyze the fragment of name once, as if it is of depth 1,
+// false if it is not found or is being visited
+func (a *analysis) fragment(name string) (fragmentAnalysis, bool) {
+	if fa, ok := a.fragments[name]; ok {
+		return fa, true
+	}
+	f := a.doc.Fragments.ForName(name)
+	if f == nil || a.visiting[name] {
+		return fragmentAnalysis{}, false
+	}
+
+	aliases := a.aliases
+	a.aliases = 0
+	a.visiting[name] = true
+	cost, depth := a.selectionSet(f.SelectionSet, f.TypeCondition, 1)
+	delete(a.visiting, name)
+	fa := fragmentAnalysis{cost, depth, a.aliases}
+	a.aliases = aliases
+
+	a.fragments[name] = fa
+	return fa, true
+}
+
+// multiplier read the int argument of field, from literals or
+// variables, then the defaults of the variable and the argument,
+// 1 if there is none
+func (a *analysis) multiplier(f *ast.Field, fc fieldCost) int {
+	arg := f.Arguments.ForName(fc.multiplier)
+	if arg == nil || arg.Value == nil {
+		return fc.defaultMultiplier()
+	}
+	v := arg.Value
+	if _, ok := a.variables[v.Raw]; v.Kind == ast.Variable && !ok {
+		def := a.op.VariableDefinitions.ForName(v.Raw)
+		if def == nil || def.DefaultValue == nil {
+			// no value at all, the argument takes its default
+			return fc.defaultMultiplier()
+		}
+		v = def.DefaultValue
+	}
+	if n, ok := intValue(v, a.variables); ok {
+		return n
+	}
+	return 1
+}
+
+// intValue of a positive int literal or variable, saturated
+func intValue(v *ast.Value, variables map[string]interface{}) (int, bool) {
+	if v == nil {
+		return 0, false
+	}
+	switch v.Kind {
+	case ast.IntValue:
+		n, err := strconv.Atoi(v.Raw)
+		if err == nil && n > 0 {
+			return n, true
+		}
+		// saturated
+		if errors.Is(err, strconv.ErrRange) && !strings.HasPrefix(v.Raw, "-") {
+			return math.MaxInt, true
+		}
+	case ast.Variable:
+		if n, ok := variables[v.Raw].(float64); ok && n > 0 {
+			if n >= math.MaxInt {
+				return math.MaxInt, true
+			}
+			return int(n), true
+		}
+	}
+	return 0, false
+}
+
+// rootFields count fields of the root selection set, fragments expanded
+func (a *analysis) rootFields(set ast.SelectionSet) int {
+	n := 0
+	for _, sel := range set {
+		switch s := sel.(type) {
+		case *ast.Field:
+			n = addCost(n, 1)
+		case *ast.InlineFragment:
+			n = addCost(n, a.rootFields(s.SelectionSet))
+		case *ast.FragmentSpread:
+			if m, ok := a.fragmentRoots[s.Name]; ok {
+				n = addCost(n, m)
+			} else if f := a.doc.Fragments.ForName(s.Name); f != nil && !a.visiting[s.Name] {
+				a.visiting[s.Name] = true
+				m := a.rootFields(f.SelectionSet)
+				delete(a.visiting, s.Name)
+				a.fragmentRoots[s.Name] = m
+				n = addCost(n, m)
+			}
+		}
+	}
+	return n
+}
+
+// maxRequestBytes of LimitConfig, 0 if unlimited
+func (l *LimitConfig) maxRequestBytes() int64 {
+	switch {
+	case l.MaxRequestBytes < 0:
+		return 0
+	case l.MaxRequestBytes == 0:
+		return defaultMaxRequestBytes
+	}
+	return l.MaxRequestBytes
+}
+
+// rejectGraphql return the error of a rejected query, the code of
+// rejection is added to access if it is not nil
+func rejectGraphql(access map[string]string, code string, format string, args ...interface{}) *graphqlRequestError {
+	if access != nil {
+		access["rejected"] = code
+	}
+	return &graphqlRequestError{
+		status:  http.StatusBadRequest,
+		message: fmt.Sprintf(format, args...),
+		code:    code,
+	}
+}
+
+// limitSize reject params of a query exceeding MaxBytes,
+// before the query is parsed
+func (e *graphqlEndpoint) limitSize(params *graphqlParams, access map[string]string) *graphqlRequestError {
+	if l := e.limits; l.MaxBytes > 0 && len(params.Query) > l.MaxBytes {
+		return rejectGraphql(access, "QUERY_TOO_LARGE", "query of %d bytes exceeds the limit of %d", len(params.Query), l.MaxBytes)
+	}
+	return nil
+}
+
+// limit reject params of a parsed query exceeding the limits, the
+// complexity and the code of rejection are added to access if it is
+// not nil
+func (e *graphqlEndpoint) limit(params *graphqlParams, access map[string]string) *graphqlRequestError {
+	l := e.limits
+
+	reject := func(code string, format string, args ...interface{}) *graphqlRequestError {
+		return rejectGraphql(access, code, format, args...)
+	}
+
+	if l.MaxDepth <= 0 && l.MaxAliases <= 0 && l.MaxRootFields <= 0 && l.MaxComplexity <= 0 {
+		return nil
+	}
+
+	doc := params.doc
+	if doc == nil {
+		// reported by the execution
+		return nil
+	}
+	var op *ast.OperationDefinition
+	if params.OperationName == "" && len(doc.Operations) == 1 {
+		op = doc.Operations[0]
+	} else {
+		op = doc.Operations.ForName(params.OperationName)
+	}
+	if op == nil {
+		return nil
+	}
+
+	a := &analysis{
+		schema:        e.costs,
+		doc:           doc,
+		op:            op,
+		variables:     params.Variables,
+		limits:        l,
+		visiting:      make(map[string]bool),
+		fragments:     make(map[string]fragmentAnalysis),
+		fragmentRoots: make(map[string]int),
+	}
+	cost, depth := a.selectionSet(op.SelectionSet, e.costs.roots[op.Operation], 1)
+	if access != nil {
+		access["complexity"] = strconv.Itoa(cost)
+	}
+
+	if l.MaxDepth > 0 && depth > l.MaxDepth {
+		return reject("QUERY_TOO_DEEP", "query depth %d exceeds the limit of %d", depth, l.MaxDepth)
+	}
+	if l.MaxAliases > 0 && a.aliases > l.MaxAliases {
+		return reject("TOO_MANY_ALIASES", "%d aliases exceed the limit of %d", a.aliases, l.MaxAliases)
+	}
+	if n := a.rootFields(op.SelectionSet); l.MaxRootFields > 0 && n > l.MaxRootFields {
+		return reject("TOO_MANY_ROOT_FIELDS", "%d root fields exceed the limit of %d", n, l.MaxRootFields)
+	}
+	if l.MaxComplexity > 0 && cost > l.MaxComplexity {
+		return reject("QUERY_TOO_COMPLEX", "query complexity %d exceeds the limit of %d", cost, l.MaxComplexity)
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package brick
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+type limitsResolver struct{}
+
+type limitsUser struct{}
+
+func (u *limitsUser) Name() string { return "bob" }
+
+func (u *limitsUser) Friends(args struct{ First *int32 }) []*limitsUser {
+	return []*limitsUser{{}}
+}
+
+func (u *limitsUser) Followers(args struct{ First int32 }) []*limitsUser {
+	return []*limitsUser{{}}
+}
+
+func (r *limitsResolver) Me() *limitsUser { return &limitsUser{} }
+
+func (r *limitsResolver) Slow(ctx context.Context) string {
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+	}
+	return "slow"
+}
+
+func TestLimits(t *testing.T) {
+	g := NewGraphql(&limitsResolver{})
+	g.Schema(`
+	type Query {
+		me: User!
+		slow: String!
+	}
+	type User {
+		name: String!
+		friends(first: Int): [User!]! @cost(value: 2, multiplier: "first")
+	}
+	`)
+	g.Limits(&LimitConfig{
+		MaxBytes:      200,
+		MaxDepth:      4,
+		MaxAliases:    2,
+		MaxRootFields: 2,
+		MaxComplexity: 15,
+		Timeout:       50 * time.Millisecond,
+	})
+	r := New()
+	r.Graphql("/graphql", g)
+
+	cases := []struct {
+		query    string
+		response string
+	}{
+		{"{ me { name } }", `{"data":{"me":{"name":"bob"}}}`},
+		{"{ me { friends { friends { friends { name } } } } }", `"code":"QUERY_TOO_DEEP"`},
+		{"{ a: me { name } b: me { name } c: me { name } }", `"code":"TOO_MANY_ALIASES"`},
+		{"{ me { name } ...f } fragment f on Query { me { name } slow }", `"code":"TOO_MANY_ROOT_FIELDS"`},
+		// me 1 + friends (2 + friends (2 + name 1 * 5) * 2)
+		{"{ me { friends(first: 2) { friends(first: 5) { name } } } }", `{"message":"query complexity 17 exceeds the limit of 15","extensions":{"code":"QUERY_TOO_COMPLEX"}}`},
+		{"{ me { friends(first: 2) { friends(first: 4) { name } } } }", `"friends":[{"friends":[{"name":"bob"}]}]`},
+		{"{ me { name } }" + string(make([]byte, 200)), `"code":"QUERY_TOO_LARGE"`},
+		{"{ slow }", `{"message":"execution timeout","extensions":{"code":"TIMEOUT"}}`},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/graphql?query="+url.QueryEscape(c.query), nil))
+		assert.Contains(t, w.Body.String(), c.response, c.query)
+	}
+}
+
+func TestLimitsAnalysis(t *testing.T) {
+	g := NewGraphql(&limitsResolver{})
+	g.Schema(`
+	type Query {
+		me: User!
+	}
+	type User {
+		name: String!
+		friends(first: Int): [User!]! @cost(value: 2, multiplier: "first")
+		followers(first: Int = 100000): [User!]! @cost(value: 2, multiplier: "first")
+	}
+	`)
+	g.Limits(&LimitConfig{MaxComplexity: 1000})
+	r := New()
+	r.Graphql("/graphql", g)
+
+	// fragments of exponential expansion
+	var b strings.Builder
+	b.WriteString("{ me { ...f0 } }")
+	for i := 0; i < 60; i++ {
+		fmt.Fprintf(&b, " fragment f%d on User { ...f%d ...f%d }", i, i+1, i+1)
+	}
+	b.WriteString(" fragment f60 on User { name }")
+
+	cases := []struct {
+		query     string
+		variables string
+		response  string
+	}{
+		{b.String(), "", `"code":"QUERY_TOO_COMPLEX"`},
+		// multipliers of overflow
+		{"{ me { friends(first: 99999999999999999999) { friends(first: 9223372036854775807) { name } } } }", "", `"code":"QUERY_TOO_COMPLEX"`},
+		{"{ me { ...f ...f } } fragment f on User { friends(first: 3) { name } }", "", `"friends":[{"name":"bob"}]`},
+		// defaults of variables
+		{"query($n: Int = 100000) { me { friends(first: $n) { name } } }", "", `"code":"QUERY_TOO_COMPLEX"`},
+		{"query($n: Int = 100000) { me { friends(first: $n) { name } } }", `{"n":3}`, `"friends":[{"name":"bob"}]`},
+		// defaults of arguments
+		{"{ me { followers { name } } }", "", `"code":"QUERY_TOO_COMPLEX"`},
+		{"query($n: Int) { me { followers(first: $n) { name } } }", "", `"code":"QUERY_TOO_COMPLEX"`},
+		{"{ me { followers(first: 3) { name } } }", "", `"followers":[{"name":"bob"}]`},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		body := `{"query":` + strconv.Quote(c.query)
+		if c.variables != "" {
+			body += `,"variables":` + c.variables
+		}
+		req := httptest.NewRequest("POST", "/graphql", strings.NewReader(body+`}`))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		assert.Contains(t, w.Body.String(), c.response, c.query)
+	}
+}
+
+func TestLimitsRequestBytes(t *testing.T) {
+	g := NewGraphql(&limitsResolver{})
+	g.Schema(`
+	type Query {
+		me: User!
+	}
+	type User {
+		name: String!
+	}
+	`)
+	g.Limits(&LimitConfig{MaxRequestBytes: 100})
+	r := New()
+	r.Graphql("/graphql", g)
+
+	large := `{"query":"{ me { name } }` + strings.Repeat(" ", 100) + `"}`
+	cases := []struct {
+		method, target, body string
+		status               int
+	}{
+		{"POST", "/graphql", `{"query":"{ me { name } }"}`, 200},
+		{"POST", "/graphql", large, 413},
+		{"POST", "/graphql", "[" + large + "]", 413},
+		{"GET", "/graphql?query=" + url.QueryEscape("{ me { name } }"), "", 200},
+		{"GET", "/graphql?query=" + url.QueryEscape("{ me { name } }"+strings.Repeat(" ", 100)), "", 414},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, c.status, w.Code, c.target)
+		if c.status != 200 {
+			assert.Contains(t, w.Body.String(), `"code":"QUERY_TOO_LARGE"`, c.target)
+		}
+	}
+}
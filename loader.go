@@ -0,0 +1,273 @@
+package brick
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	ot "github.com/opentracing/opentracing-go"
+	otext "github.com/opentracing/opentracing-go/ext"
+)
+
+// BatchFunc fetch values of keys, keys absent from the result map are
+// loaded as nil, an error fails all keys of the batch
+type BatchFunc = func(ctx context.Context, keys []interface{}) (map[interface{}]interface{}, error)
+
+// LoaderConfig config of a Loader
+type LoaderConfig struct {
+	// Wait is the batching window, Loads within it are fetched in one
+	// batch, 1ms if zero
+	Wait time.Duration
+	// MaxBatch size, a batch is fetched as soon as it is full, 100 if zero
+	MaxBatch int
+}
+
+// Loader is a DataLoader: Loads of a request are coalesced into batches,
+// and results are cached for the life of the request. Loaders are created
+// once, and instantiated for every request by LoaderMiddleware
+type Loader struct {
+	name  string
+	fetch BatchFunc
+	cfg   LoaderConfig
+}
+
+// NewLoader create a Loader, name is used in the access log and spans.
+// Keys must be comparable, e.g. int64 or string
+func NewLoader(name string, fetch BatchFunc, cfg *LoaderConfig) *Loader {
+	l := &Loader{name: name, fetch: fetch}
+	if cfg != nil {
+		l.cfg = *cfg
+	}
+	if l.cfg.Wait <= 0 {
+		l.cfg.Wait = time.Millisecond
+	}
+	if l.cfg.MaxBatch <= 0 {
+		l.cfg.MaxBatch = 100
+	}
+	return l
+}
+
+// loaderScope is the loaders of a request
+type loaderScope struct {
+	sync.Mutex
+	instances map[*Loader]*loaderInstance
+	// in the order of first Load, for stable logs
+	order []*loaderInstance
+}
+
+// LoaderMiddleware instantiate loaders for the request, and add stats
+// of them to the access log and the span of the request, e.g.
+// loader.user="loads=12 hits=8 batches=1 keys=4 max_batch=4"
+func LoaderMiddleware(ctx context.Context, next Handle) {
+	if value(ctx, "loaders") != nil {
+		// registered by a parent route already
+		next(ctx)
+		return
+	}
+
+	scope := &loaderScope{instances: make(map[*Loader]*loaderInstance)}
+	defer func() {
+		scope.Lock()
+		defer scope.Unlock()
+
+		access, _ := value(ctx, "access").(map[string]string)
+		span := ot.SpanFromContext(ctx)
+		for _, i := range scope.order {
+			s := i.stats()
+			if access != nil {
+				access["loader."+i.loader.name] = fmt.Sprintf(
+					"loads=%d hits=%d batches=%d keys=%d max_batch=%d",
+					s.loads, s.hits, s.batches, s.keys, s.maxBatch,
+				)
+			}
+			if span != nil && s.loads > 0 {
+				span.SetTag("loader."+i.loader.name+".hit_rate", float64(s.hits)/float64(s.loads))
+				span.SetTag("loader."+i.loader.name+".batches", s.batches)
+			}
+		}
+	}()
+
+	next(withValue(ctx, "loaders", scope))
+}
+
+// Load the value of key, in a batch with other Loads of the request
+func (l *Loader) Load(ctx context.Context, key interface{}) (interface{}, error) {
+	scope, ok := value(ctx, "loaders").(*loaderScope)
+	if !ok {
+		log.Panic().Str("loader", l.name).Msg("expect brick.LoaderMiddleware")
+	}
+
+	scope.Lock()
+	i := scope.instances[l]
+	if i == nil {
+		i = &loaderInstance{
+			loader: l,
+			cache:  make(map[interface{}]*loaderResult),
+		}
+		scope.instances[l] = i
+		scope.order = append(scope.order, i)
+	}
+	scope.Unlock()
+
+	result := i.load(ctx, key)
+	select {
+	case <-result.done:
+		return result.value, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// LoadMany load values of keys, in the order of keys
+func (l *Loader) LoadMany(ctx context.Context, keys []interface{}) ([]interface{}, error) {
+	values := make([]interface{}, len(keys))
+	errs := make([]error, len(keys))
+
+	var wg sync.WaitGroup
+	for n, key := range keys {
+		wg.Add(1)
+		go func(n int, key interface{}) {
+			defer wg.Done()
+			values[n], errs[n] = l.Load(ctx, key)
+		}(n, key)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return values, err
+		}
+	}
+	return values, nil
+}
+
+type loaderResult struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+type loaderStats struct {
+	loads, hits, batches, keys, maxBatch int
+}
+
+// loaderInstance is a Loader of a request
+type loaderInstance struct {
+	loader *Loader
+
+	sync.Mutex
+	cache map[interface{}]*loaderResult
+	// batch waiting for the batching window, nil if there is none
+	batch *loaderBatch
+	s     loaderStats
+}
+
+// loaderBatch is the keys to fetch at once
+type loaderBatch struct {
+	// ctx of the first Load, without its cancellation, for the batch is
+	// shared by other Loads, which wait on their own ctx
+	ctx     context.Context
+	keys    []interface{}
+	results []*loaderResult
+}
+
+func (i *loaderInstance) stats() loaderStats {
+	i.Lock()
+	defer i.Unlock()
+	return i.s
+}
+
+// load return the cached result of key, or add key to the pending batch
+func (i *loaderInstance) load(ctx context.Context, key interface{}) *loaderResult {
+	i.Lock()
+	defer i.Unlock()
+
+	i.s.loads++
+	if result, ok := i.cache[key]; ok {
+		// loaded, or being loaded
+		i.s.hits++
+		return result
+	}
+
+	result := &loaderResult{done: make(chan struct{})}
+	i.cache[key] = result
+
+	b := i.batch
+	if b == nil {
+		b = &loaderBatch{ctx: context.WithoutCancel(ctx)}
+		i.batch = b
+		time.AfterFunc(i.loader.cfg.Wait, func() {
+			i.Lock()
+			pending := i.batch == b
+			if pending {
+				i.batch = nil
+			}
+			i.Unlock()
+
+			// or dispatched as it was full
+			if pending {
+				i.dispatch(b)
+			}
+		})
+	}
+	b.keys = append(b.keys, key)
+	b.results = append(b.results, result)
+
+	if len(b.keys) >= i.loader.cfg.MaxBatch {
+		i.batch = nil
+		go i.dispatch(b)
+	}
+
+	return result
+}
+
+// dispatch fetch the batch, and resolve the results
+func (i *loaderInstance) dispatch(b *loaderBatch) {
+	i.Lock()
+	i.s.batches++
+	i.s.keys += len(b.keys)
+	if len(b.keys) > i.s.maxBatch {
+		i.s.maxBatch = len(b.keys)
+	}
+	i.Unlock()
+
+	values, err := i.fetch(b.ctx, b.keys)
+
+	i.Lock()
+	defer i.Unlock()
+	for n, key := range b.keys {
+		if err != nil {
+			// not cached, the next Load retries
+			delete(i.cache, key)
+			b.results[n].err = err
+		} else {
+			b.results[n].value = values[key]
+		}
+		close(b.results[n].done)
+	}
+}
+
+// fetch keys with a span, panics are returned as errors
+func (i *loaderInstance) fetch(ctx context.Context, keys []interface{}) (values map[interface{}]interface{}, err error) {
+	span, ctx := ot.StartSpanFromContext(ctx, "loader."+i.loader.name)
+	defer span.Finish()
+	span.SetTag("loader.batch_size", len(keys))
+
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				// e.g. business errors thrown by error.Throw
+				err = e
+			} else {
+				err = fmt.Errorf("loader %s: panic: %v", i.loader.name, r)
+			}
+		}
+		if err != nil {
+			otext.Error.Set(span, true)
+			span.LogKV("error", err.Error())
+		}
+	}()
+
+	return i.loader.fetch(ctx, keys)
+}
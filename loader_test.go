@@ -0,0 +1,148 @@
+package brick
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	be "github.com/pickjunk/brick/error"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestLoader(t *testing.T) {
+	assert := assert.New(t)
+
+	var mu sync.Mutex
+	var batches [][]interface{}
+	users := NewLoader("user", func(ctx context.Context, keys []interface{}) (map[interface{}]interface{}, error) {
+		mu.Lock()
+		batches = append(batches, keys)
+		mu.Unlock()
+
+		values := make(map[interface{}]interface{})
+		for _, key := range keys {
+			if id := key.(int); id > 0 {
+				values[id] = id * 10
+			}
+		}
+		return values, nil
+	}, &LoaderConfig{MaxBatch: 3})
+
+	var access map[string]string
+	r := New()
+	r.GET("/", func(ctx context.Context, next Handle) {
+		next(ctx)
+		access = Access(ctx)
+	}, LoaderMiddleware, func(ctx context.Context) {
+		// 1 and 2 are loaded twice, 0 is not found
+		keys := []interface{}{1, 2, 1, 2, 3, 0}
+		values, err := users.LoadMany(ctx, keys)
+		assert.Nil(err)
+		assert.Equal([]interface{}{10, 20, 10, 20, 30, nil}, values)
+
+		// cached
+		v, err := users.Load(ctx, 3)
+		assert.Nil(err)
+		assert.Equal(30, v)
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	// 4 distinct keys, in batches of at most 3
+	total := 0
+	for _, keys := range batches {
+		assert.True(len(keys) <= 3)
+		total += len(keys)
+	}
+	assert.Equal(4, total)
+	assert.Equal(2, len(batches))
+	assert.Equal("loads=7 hits=3 batches=2 keys=4 max_batch=3", access["loader.user"])
+
+	// cached for the request only
+	batches = nil
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.Equal(2, len(batches))
+}
+
+func TestLoaderError(t *testing.T) {
+	assert := assert.New(t)
+
+	calls := 0
+	failing := NewLoader("failing", func(ctx context.Context, keys []interface{}) (map[interface{}]interface{}, error) {
+		calls++
+		switch calls {
+		case 1:
+			return nil, errors.New("failed")
+		case 2:
+			be.Throw(10001, "business")
+		}
+		return map[interface{}]interface{}{"a": "A"}, nil
+	}, nil)
+
+	ctx := withValue(context.Background(), "loaders", &loaderScope{instances: make(map[*Loader]*loaderInstance)})
+
+	_, err := failing.Load(ctx, "a")
+	assert.EqualError(err, "failed")
+
+	// errors are not cached
+	_, err = failing.Load(ctx, "a")
+	bErr, ok := err.(*be.BusinessError)
+	assert.True(ok)
+	assert.Equal(10001, bErr.Code)
+
+	v, err := failing.Load(ctx, "a")
+	assert.Nil(err)
+	assert.Equal("A", v)
+	assert.Equal(3, calls)
+
+	assert.PanicsWithValue("expect brick.LoaderMiddleware", func() {
+		failing.Load(context.Background(), "a")
+	})
+}
+
+func TestLoaderCancel(t *testing.T) {
+	assert := assert.New(t)
+
+	release := make(chan struct{})
+	users := NewLoader("user", func(ctx context.Context, keys []interface{}) (map[interface{}]interface{}, error) {
+		<-release
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		values := make(map[interface{}]interface{})
+		for _, key := range keys {
+			values[key] = key.(int) * 10
+		}
+		return values, nil
+	}, &LoaderConfig{Wait: 50 * time.Millisecond})
+
+	ctx := withValue(context.Background(), "loaders", &loaderScope{instances: make(map[*Loader]*loaderInstance)})
+	first, cancel := context.WithCancel(ctx)
+
+	// both in the batch of the first Load
+	var wg sync.WaitGroup
+	wg.Add(2)
+	var firstErr, secondErr error
+	var second interface{}
+	go func() {
+		defer wg.Done()
+		_, firstErr = users.Load(first, 1)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		defer wg.Done()
+		second, secondErr = users.Load(ctx, 2)
+	}()
+
+	// the first Load returns once canceled, the batch goes on for others
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	close(release)
+	wg.Wait()
+
+	assert.Equal(context.Canceled, firstErr)
+	assert.Nil(secondErr)
+	assert.Equal(20, second)
+}
@@ -13,6 +13,7 @@ type Logger struct {
 
 var inner zerolog.Logger
 var outer zerolog.Logger
+var file *os.File
 
 func init() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMs
@@ -21,13 +22,14 @@ func init() {
 
 	logPath := os.Getenv("LOG_FILE")
 	if logPath != "" {
-		f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		var err error
+		file, err = os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
 			inner.Fatal().Err(err).Send()
 		}
 		inner.Info().Str("file", logPath).Msg("log redirect")
 
-		outer = zerolog.New(f).With().Timestamp().Logger()
+		outer = zerolog.New(file).With().Timestamp().Logger()
 		outer = outer.With().Str("component", "brick.log").Logger()
 		outer = outer.Level(zerolog.InfoLevel)
 	} else {
@@ -38,6 +40,19 @@ func init() {
 	outer = outer.Hook(callerHook{})
 }
 
+// Close flush and close the log file redirected by env LOG_FILE,
+// do nothing if the log is not redirected.
+// Make sure it is the last thing to do before exit
+func Close() error {
+	if file == nil {
+		return nil
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
 // New a logger
 func New(component string) *Logger {
 	l := outer.With().Str("component", component).Logger()
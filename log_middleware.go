@@ -1,7 +1,9 @@
 package brick
 
 import (
+	"bufio"
 	"context"
+	"net"
 	"net/http"
 	"os"
 	"regexp"
@@ -9,6 +11,7 @@ import (
 
 	ot "github.com/opentracing/opentracing-go"
 	otext "github.com/opentracing/opentracing-go/ext"
+	bm "github.com/pickjunk/brick/metrics"
 	"github.com/rs/zerolog"
 )
 
@@ -30,6 +33,25 @@ func (w *statusWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// Flush implement http.Flusher, for streaming responses
+func (w *statusWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack implement http.Hijacker, for websocket
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap for http.ResponseController
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func ip(r *http.Request) string {
 	// client ip
 	ip := r.RemoteAddr
@@ -61,8 +83,24 @@ func logMiddleware(ctx context.Context, next Handle) {
 	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
 	ctx = withValue(ctx, "http", &HTTP{sw, r, ps})
 
-	span, ctx := ot.StartSpanFromContext(ctx, "http")
+	// continue the trace from upstream if any
+	tracer := ot.GlobalTracer()
+	var span ot.Span
+	parent, err := extractSpanContext(tracer, r.Header)
+	if err == nil {
+		span = tracer.StartSpan("http", otext.RPCServerOption(parent))
+	} else {
+		if err != ot.ErrSpanContextNotFound {
+			log.Warn().Err(err).Msg("extract span context")
+		}
+		span = tracer.StartSpan("http")
+	}
 	defer span.Finish()
+	ctx = ot.ContextWithSpan(ctx, span)
+	if id := traceID(span); id != "" {
+		access["trace_id"] = id
+	}
+
 	start := time.Now()
 	next(ctx)
 	duration := time.Now().Sub(start)
@@ -74,6 +112,11 @@ func logMiddleware(ctx context.Context, next Handle) {
 		otext.Error.Set(span, true)
 	}
 
+	labels := []string{r.Method, Route(ctx), bm.StatusClass(sw.status)}
+	bm.HTTPRequests.WithLabelValues(labels...).Inc()
+	bm.HTTPDuration.WithLabelValues(labels...).Observe(duration.Seconds())
+	bm.HTTPResponseSize.WithLabelValues(labels...).Observe(float64(sw.length))
+
 	var e *zerolog.Event
 	switch s := sw.status; {
 	case s >= 200 && s < 300:
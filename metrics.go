@@ -0,0 +1,55 @@
+package brick
+
+import (
+	"sync"
+
+	bm "github.com/pickjunk/brick/metrics"
+)
+
+// Metrics expose the brick metrics registry on path
+// in the prometheus text format, without middlewares
+// (so scrapes are not logged as access)
+func (r *Router) Metrics(path string) *Router {
+	r.Router.Handler("GET", r.prefix+path, bm.Handler())
+	return r
+}
+
+// maxOperationLabels of distinct operation names in metrics of
+// a graphql endpoint, operations beyond are labeled "other"
+const maxOperationLabels = 100
+
+// operationLabels bound the operation label of graphql metrics, whose
+// names are sent by clients: queries of the allow list of persisted
+// queries are labeled by name, others by the first maxOperationLabels
+// names seen, then "other"
+type operationLabels struct {
+	sync.Mutex
+	names map[string]bool
+}
+
+func (l *operationLabels) label(params *graphqlParams) string {
+	name := params.OperationName
+	if name == "" {
+		return "anonymous"
+	}
+	// names of no operation of the query are never executed
+	if params.doc == nil || params.doc.Operations.ForName(name) == nil {
+		return "other"
+	}
+	if params.known {
+		return name
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	if l.names == nil {
+		l.names = make(map[string]bool)
+	}
+	if !l.names[name] {
+		if len(l.names) >= maxOperationLabels {
+			return "other"
+		}
+		l.names[name] = true
+	}
+	return name
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"net/http"
+
+	prometheus "github.com/prometheus/client_golang/prometheus"
+	collectors "github.com/prometheus/client_golang/prometheus/collectors"
+	promhttp "github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry of brick metrics, register your own collectors here
+// to expose them with the builtin ones
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts http requests
+	// by method, route pattern and status class
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "brick_http_requests_total",
+		Help: "Total number of http requests.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPDuration observes http request latencies in seconds
+	// by method, route pattern and status class
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "brick_http_request_duration_seconds",
+		Help:    "Latency of http requests in seconds.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// HTTPResponseSize observes http response sizes in bytes
+	// by method, route pattern and status class
+	HTTPResponseSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "brick_http_response_size_bytes",
+		Help:    "Size of http responses in bytes.",
+		Buckets: prometheus.ExponentialBuckets(100, 10, 6),
+	}, []string{"method", "route", "status"})
+
+	// GraphqlOperations counts graphql operations
+	// by operation name and result (ok, error)
+	GraphqlOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "brick_graphql_operations_total",
+		Help: "Total number of graphql operations.",
+	}, []string{"operation", "result"})
+
+	// GraphqlDuration observes graphql operation latencies in seconds
+	// by operation name and result (ok, error)
+	GraphqlDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "brick_graphql_operation_duration_seconds",
+		Help:    "Latency of graphql operations in seconds.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation", "result"})
+
+	// GraphqlFieldDuration observes graphql field latencies in seconds
+	// by type, field and result (ok, error), including the time of child
+	// fields, fields resolved without context or error are not observed
+	// unless TracingConfig.TrivialFields
+	GraphqlFieldDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "brick_graphql_field_duration_seconds",
+		Help:    "Latency of graphql fields in seconds, including their child fields.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"type", "field", "result"})
+
+	// DBDuration observes dbr query latencies in seconds by dbr event
+	DBDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "brick_db_query_duration_seconds",
+		Help:    "Latency of dbr queries in seconds.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"event"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		HTTPResponseSize,
+		GraphqlOperations,
+		GraphqlDuration,
+		GraphqlFieldDuration,
+		DBDuration,
+	)
+}
+
+// StatusClass of a http status code, e.g. 2xx, 5xx
+func StatusClass(status int) string {
+	switch {
+	case status >= 100 && status < 600:
+		return string(rune('0'+status/100)) + "xx"
+	default:
+		return "unknown"
+	}
+}
+
+// Handler serve Registry in the prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
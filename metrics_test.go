@@ -0,0 +1,60 @@
+package brick
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+	ast "github.com/vektah/gqlparser/v2/ast"
+	parser "github.com/vektah/gqlparser/v2/parser"
+)
+
+func TestMetrics(t *testing.T) {
+	r := New()
+	r.Metrics("/metrics")
+	r.Prefix("/metrics-test").GET("/hello/:name", func(ctx context.Context) {
+		Response(ctx).Write([]byte("hello"))
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics-test/hello/a", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics-test/hello/b", nil))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+
+	assert.Contains(t, body, `brick_http_requests_total{method="GET",route="/metrics-test/hello/:name",status="2xx"} 2`)
+	assert.Contains(t, body, `brick_http_request_duration_seconds_count{method="GET",route="/metrics-test/hello/:name",status="2xx"} 2`)
+	assert.Contains(t, body, `brick_http_response_size_bytes_sum{method="GET",route="/metrics-test/hello/:name",status="2xx"} 10`)
+	// scrapes are not counted
+	assert.NotContains(t, body, `route="/metrics"`)
+}
+
+func TestOperationLabels(t *testing.T) {
+	assert := assert.New(t)
+
+	params := func(name string) *graphqlParams {
+		doc, _ := parser.ParseQuery(&ast.Source{Input: "query " + name + " { a }"})
+		return &graphqlParams{OperationName: name, doc: doc}
+	}
+
+	l := &operationLabels{}
+	assert.Equal("anonymous", l.label(&graphqlParams{}))
+	// names of no operation of the query
+	assert.Equal("other", l.label(&graphqlParams{OperationName: "a", doc: params("b").doc}))
+
+	for i := 0; i < maxOperationLabels; i++ {
+		name := fmt.Sprintf("op%d", i)
+		assert.Equal(name, l.label(params(name)))
+	}
+	// beyond the cap
+	assert.Equal("other", l.label(params("extra")))
+	assert.Equal("op0", l.label(params("op0")))
+
+	// queries of the allow list
+	known := params("known")
+	known.known = true
+	assert.Equal("known", l.label(known))
+}
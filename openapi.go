@@ -0,0 +1,459 @@
+package brick
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	httprouter "github.com/julienschmidt/httprouter"
+	be "github.com/pickjunk/brick/error"
+	yaml "go.yaml.in/yaml/v3"
+)
+
+// OpenAPIInfo info object of the OpenAPI document
+type OpenAPIInfo struct {
+	Title       string `json:"title" yaml:"title"`
+	Version     string `json:"version" yaml:"version"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// OpenAPIDocument OpenAPI 3.1 document
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi" yaml:"openapi"`
+	Info       OpenAPIInfo                             `json:"info" yaml:"info"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths" yaml:"paths"`
+	Components OpenAPIComponents                       `json:"components" yaml:"components"`
+}
+
+// OpenAPIComponents components object
+type OpenAPIComponents struct {
+	Schemas map[string]*OpenAPISchema `json:"schemas" yaml:"schemas"`
+}
+
+// OpenAPIOperation operation object
+type OpenAPIOperation struct {
+	Summary     string                      `json:"summary,omitempty" yaml:"summary,omitempty"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty" yaml:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses" yaml:"responses"`
+}
+
+// OpenAPIParameter parameter object
+type OpenAPIParameter struct {
+	Name     string         `json:"name" yaml:"name"`
+	In       string         `json:"in" yaml:"in"`
+	Required bool           `json:"required,omitempty" yaml:"required,omitempty"`
+	Schema   *OpenAPISchema `json:"schema" yaml:"schema"`
+}
+
+// OpenAPIRequestBody request body object
+type OpenAPIRequestBody struct {
+	Required bool                         `json:"required,omitempty" yaml:"required,omitempty"`
+	Content  map[string]*OpenAPIMediaType `json:"content" yaml:"content"`
+}
+
+// OpenAPIResponse response object
+type OpenAPIResponse struct {
+	Description string                       `json:"description" yaml:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty" yaml:"content,omitempty"`
+}
+
+// OpenAPIMediaType media type object
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema" yaml:"schema"`
+}
+
+// OpenAPISchema schema object, a subset of JSON Schema
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty" yaml:"type,omitempty"`
+	Format               string                    `json:"format,omitempty" yaml:"format,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty" yaml:"items,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty" yaml:"properties,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty" yaml:"additionalProperties,omitempty"`
+	Required             []string                  `json:"required,omitempty" yaml:"required,omitempty"`
+	OneOf                []*OpenAPISchema          `json:"oneOf,omitempty" yaml:"oneOf,omitempty"`
+	Enum                 []interface{}             `json:"enum,omitempty" yaml:"enum,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	Minimum              *float64                  `json:"minimum,omitempty" yaml:"minimum,omitempty"`
+	Maximum              *float64                  `json:"maximum,omitempty" yaml:"maximum,omitempty"`
+	MinLength            *int                      `json:"minLength,omitempty" yaml:"minLength,omitempty"`
+	MaxLength            *int                      `json:"maxLength,omitempty" yaml:"maxLength,omitempty"`
+	MinItems             *int                      `json:"minItems,omitempty" yaml:"minItems,omitempty"`
+	MaxItems             *int                      `json:"maxItems,omitempty" yaml:"maxItems,omitempty"`
+}
+
+// OpenAPIDocument generate the OpenAPI 3.1 document of all routes
+// registered on the Router. Request and response schemas are derived
+// from the types of TypedHandle created by JSON, other routes are
+// documented with their path parameters only.
+func (r *Router) OpenAPIDocument(info OpenAPIInfo) *OpenAPIDocument {
+	g := &schemaGenerator{
+		schemas: make(map[string]*OpenAPISchema),
+		types:   make(map[string]reflect.Type),
+	}
+
+	doc := &OpenAPIDocument{
+		OpenAPI: "3.1.0",
+		Info:    info,
+		Paths:   make(map[string]map[string]*OpenAPIOperation),
+	}
+
+	for _, reg := range r.routes.all() {
+		path, params := openAPIPath(reg.path)
+
+		op := &OpenAPIOperation{
+			Summary:   reg.handler,
+			Responses: make(map[string]*OpenAPIResponse),
+		}
+
+		var in reflect.Type
+		if reg.typed != nil {
+			in = structType(reg.typed.In)
+		}
+
+		for _, name := range params {
+			schema := &OpenAPISchema{Type: "string"}
+			if in != nil {
+				if sf, ok := findField(in, "path", name); ok {
+					schema = g.field(sf)
+				}
+			}
+			op.Parameters = append(op.Parameters, &OpenAPIParameter{
+				Name:     name,
+				In:       "path",
+				Required: true,
+				Schema:   schema,
+			})
+		}
+
+		if reg.typed != nil {
+			g.operation(op, reg.method, reg.typed)
+		} else {
+			op.Responses["default"] = &OpenAPIResponse{Description: "response"}
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*OpenAPIOperation)
+		}
+		doc.Paths[path][strings.ToLower(reg.method)] = op
+	}
+
+	doc.Components.Schemas = g.schemas
+	return doc
+}
+
+// OpenAPI serve the OpenAPI document on path+".json" and path+".yaml",
+// without middlewares
+func (r *Router) OpenAPI(path string, info OpenAPIInfo) *Router {
+	r.routes.Lock()
+	r.routes.openapi = &info
+	r.routes.Unlock()
+
+	r.Router.Handle("GET", r.prefix+path+".json", func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.OpenAPIDocument(info))
+	})
+	r.Router.Handle("GET", r.prefix+path+".yaml", func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "application/yaml")
+		yaml.NewEncoder(w).Encode(r.OpenAPIDocument(info))
+	})
+	return r
+}
+
+// openAPIPath convert httprouter :param and *catchall to {param},
+// return the converted path and the names of parameters
+func openAPIPath(path string) (string, []string) {
+	var params []string
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+			params = append(params, s[1:])
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// structType deref pointers to the struct
+func structType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// findField find the field of a struct by the binding tag
+func findField(t reflect.Type, tag, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			if f, ok := findField(sf.Type, tag, name); ok {
+				return f, true
+			}
+			continue
+		}
+		if sf.Tag.Get(tag) == name {
+			return sf, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	rawMessageType  = reflect.TypeOf(json.RawMessage{})
+	invalidNameChar = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+)
+
+type schemaGenerator struct {
+	schemas map[string]*OpenAPISchema
+	// types of named schemas, to resolve name conflicts
+	types map[string]reflect.Type
+}
+
+func (g *schemaGenerator) operation(op *OpenAPIOperation, method string, typed *TypedHandle) {
+	in := structType(typed.In)
+
+	// query and header parameters
+	var params func(t reflect.Type)
+	params = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+				params(sf.Type)
+				continue
+			}
+			for _, tag := range []string{"query", "header"} {
+				if name := sf.Tag.Get(tag); name != "" {
+					op.Parameters = append(op.Parameters, &OpenAPIParameter{
+						Name:     name,
+						In:       tag,
+						Required: hasRule(sf, "required"),
+						Schema:   g.field(sf),
+					})
+				}
+			}
+		}
+	}
+	params(in)
+
+	switch method {
+	case "POST", "PUT", "PATCH":
+		content := make(map[string]*OpenAPIMediaType)
+		if body := g.object(in, func(sf reflect.StructField) string {
+			if sf.Tag.Get("path") != "" || sf.Tag.Get("query") != "" ||
+				sf.Tag.Get("header") != "" || sf.Tag.Get("form") != "" {
+				return ""
+			}
+			return jsonName(sf)
+		}); len(body.Properties) > 0 {
+			content["application/json"] = &OpenAPIMediaType{Schema: body}
+		}
+		if form := g.object(in, func(sf reflect.StructField) string {
+			return sf.Tag.Get("form")
+		}); len(form.Properties) > 0 {
+			content["multipart/form-data"] = &OpenAPIMediaType{Schema: form}
+		}
+		if len(content) > 0 {
+			op.RequestBody = &OpenAPIRequestBody{Required: true, Content: content}
+		}
+	}
+
+	op.Responses["200"] = &OpenAPIResponse{
+		Description: "success, or a business error",
+		Content: map[string]*OpenAPIMediaType{
+			"application/json": {Schema: &OpenAPISchema{
+				OneOf: []*OpenAPISchema{
+					g.schema(typed.Out),
+					g.schema(reflect.TypeOf(be.BusinessError{})),
+				},
+			}},
+		},
+	}
+	op.Responses["400"] = &OpenAPIResponse{
+		Description: "bad input",
+		Content: map[string]*OpenAPIMediaType{
+			"application/json": {Schema: g.schema(reflect.TypeOf(BindError{}))},
+		},
+	}
+	op.Responses["500"] = &OpenAPIResponse{Description: "internal server error"}
+}
+
+func jsonName(sf reflect.StructField) string {
+	tag := sf.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name
+	}
+	return sf.Name
+}
+
+func hasRule(sf reflect.StructField, name string) bool {
+	for _, r := range parseRules(sf.Tag.Get("validate")) {
+		if r.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// schema of a type, named structs are put in components and referenced
+func (g *schemaGenerator) schema(t reflect.Type) *OpenAPISchema {
+	for t.Kind() == reflect.Ptr {
+		if t == fileHeaderType {
+			return &OpenAPISchema{Type: "string", Format: "binary"}
+		}
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &OpenAPISchema{}
+	}
+	if t.Kind() != reflect.Struct && reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return &OpenAPISchema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &OpenAPISchema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &OpenAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &OpenAPISchema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &OpenAPISchema{Type: "number", Format: "double"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json encodes []byte as base64
+			return &OpenAPISchema{Type: "string", Format: "byte"}
+		}
+		return &OpenAPISchema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &OpenAPISchema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t, jsonName)
+		}
+
+		name := g.name(t)
+		if _, ok := g.schemas[name]; !ok {
+			// placeholder for recursive types
+			g.schemas[name] = &OpenAPISchema{}
+			*g.schemas[name] = *g.object(t, jsonName)
+		}
+		return &OpenAPISchema{Ref: "#/components/schemas/" + name}
+	default:
+		// interface{} and others, any value
+		return &OpenAPISchema{}
+	}
+}
+
+// name of the component schema of a named type, qualified
+// by the package if the short name is taken by another type
+func (g *schemaGenerator) name(t reflect.Type) string {
+	name := invalidNameChar.ReplaceAllString(t.Name(), "_")
+	if other, ok := g.types[name]; ok && other != t {
+		name = invalidNameChar.ReplaceAllString(t.PkgPath()+"."+t.Name(), "_")
+	}
+	g.types[name] = t
+	return name
+}
+
+// object schema of the struct fields named by fieldName,
+// fields with an empty name are skipped
+func (g *schemaGenerator) object(t reflect.Type, fieldName func(reflect.StructField) string) *OpenAPISchema {
+	s := &OpenAPISchema{
+		Type:       "object",
+		Properties: make(map[string]*OpenAPISchema),
+	}
+
+	var fields func(t reflect.Type)
+	fields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if sf.Anonymous && sf.Type.Kind() == reflect.Struct && sf.Tag.Get("json") == "" {
+				fields(sf.Type)
+				continue
+			}
+			if sf.PkgPath != "" {
+				continue
+			}
+			name := fieldName(sf)
+			if name == "" {
+				continue
+			}
+			s.Properties[name] = g.field(sf)
+			if hasRule(sf, "required") {
+				s.Required = append(s.Required, name)
+			}
+		}
+	}
+	fields(t)
+
+	return s
+}
+
+// field schema, with the constraints of validate rules
+func (g *schemaGenerator) field(sf reflect.StructField) *OpenAPISchema {
+	s := g.schema(sf.Type)
+	rules := parseRules(sf.Tag.Get("validate"))
+	if len(rules) == 0 || s.Ref != "" {
+		return s
+	}
+
+	for _, r := range rules {
+		switch r.name {
+		case "min", "max":
+			n, err := strconv.ParseFloat(r.param, 64)
+			if err != nil {
+				continue
+			}
+			i := int(n)
+			switch s.Type {
+			case "string":
+				if r.name == "min" {
+					s.MinLength = &i
+				} else {
+					s.MaxLength = &i
+				}
+			case "array":
+				if r.name == "min" {
+					s.MinItems = &i
+				} else {
+					s.MaxItems = &i
+				}
+			case "integer", "number":
+				if r.name == "min" {
+					s.Minimum = &n
+				} else {
+					s.Maximum = &n
+				}
+			}
+		case "enum":
+			for _, e := range strings.Split(r.param, "|") {
+				if n, err := strconv.ParseFloat(e, 64); err == nil && (s.Type == "integer" || s.Type == "number") {
+					s.Enum = append(s.Enum, n)
+				} else {
+					s.Enum = append(s.Enum, e)
+				}
+			}
+		case "regex":
+			s.Pattern = r.param
+		}
+	}
+	return s
+}
@@ -0,0 +1,94 @@
+package brick
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+type userIn struct {
+	ID    int64  `path:"id" validate:"min=1"`
+	Token string `header:"X-Token" validate:"required"`
+	Name  string `json:"name" validate:"required,max=20"`
+	Role  string `json:"role" validate:"enum=admin|guest"`
+}
+
+type userOut struct {
+	ID      int64      `json:"id"`
+	Tags    []string   `json:"tags"`
+	Created time.Time  `json:"created"`
+	Friends []*userOut `json:"friends,omitempty"`
+}
+
+func TestOpenAPI(t *testing.T) {
+	r := New()
+	r.GET("/greet/:name", JSON(greet))
+	r.PUT("/users/:id", JSON(func(ctx context.Context, in *userIn) (userOut, error) {
+		return userOut{}, nil
+	}))
+	r.POST("/upload", JSON(func(ctx context.Context, in struct {
+		File *multipart.FileHeader `form:"file" validate:"required"`
+	}) (map[string]int, error) {
+		return nil, nil
+	}))
+	r.GET("/static/*filepath", func(ctx context.Context) {})
+	r.OpenAPI("/openapi", OpenAPIInfo{Title: "test", Version: "1.0.0"})
+
+	doc := r.OpenAPIDocument(OpenAPIInfo{Title: "test", Version: "1.0.0"})
+	assert.Equal(t, "3.1.0", doc.OpenAPI)
+	assert.Len(t, doc.Paths, 4)
+
+	greetOp := doc.Paths["/greet/{name}"]["get"]
+	assert.Nil(t, greetOp.RequestBody)
+	assert.Equal(t, "name", greetOp.Parameters[0].Name)
+	assert.Equal(t, 5, *greetOp.Parameters[0].Schema.MaxLength)
+	assert.Equal(t, "fail", greetOp.Parameters[1].Name)
+	assert.Equal(t, "query", greetOp.Parameters[1].In)
+	assert.Equal(t, "#/components/schemas/greetOut", greetOp.Responses["200"].Content["application/json"].Schema.OneOf[0].Ref)
+	assert.Equal(t, "#/components/schemas/BusinessError", greetOp.Responses["200"].Content["application/json"].Schema.OneOf[1].Ref)
+	assert.Equal(t, "#/components/schemas/BindError", greetOp.Responses["400"].Content["application/json"].Schema.Ref)
+
+	userOp := doc.Paths["/users/{id}"]["put"]
+	assert.Equal(t, "integer", userOp.Parameters[0].Schema.Type)
+	assert.Equal(t, float64(1), *userOp.Parameters[0].Schema.Minimum)
+	assert.Equal(t, "header", userOp.Parameters[1].In)
+	assert.True(t, userOp.Parameters[1].Required)
+	body := userOp.RequestBody.Content["application/json"].Schema
+	assert.Equal(t, []string{"name"}, body.Required)
+	assert.Len(t, body.Properties, 2)
+	assert.Equal(t, []interface{}{"admin", "guest"}, body.Properties["role"].Enum)
+
+	user := doc.Components.Schemas["userOut"]
+	assert.Equal(t, "date-time", user.Properties["created"].Format)
+	assert.Equal(t, "#/components/schemas/userOut", user.Properties["friends"].Items.Ref)
+
+	upload := doc.Paths["/upload"]["post"].RequestBody.Content["multipart/form-data"].Schema
+	assert.Equal(t, "binary", upload.Properties["file"].Format)
+
+	static := doc.Paths["/static/{filepath}"]["get"]
+	assert.Equal(t, "filepath", static.Parameters[0].Name)
+	assert.NotNil(t, static.Responses["default"])
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	assert.Equal(t, 200, w.Code)
+	var served OpenAPIDocument
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &served))
+	assert.Equal(t, "test", served.Info.Title)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.yaml", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "openapi: 3.1.0")
+
+	var out bytes.Buffer
+	assert.Nil(t, r.run([]string{"openapi", "-yaml", "-version", "2.0.0"}, &out))
+	assert.Contains(t, out.String(), "version: 2.0.0")
+	assert.Contains(t, out.String(), "title: test")
+}
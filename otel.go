@@ -0,0 +1,126 @@
+package brick
+
+import (
+	"context"
+	"io"
+	"os"
+
+	ot "github.com/opentracing/opentracing-go"
+	b3 "go.opentelemetry.io/contrib/propagators/b3"
+	jaegerprop "go.opentelemetry.io/contrib/propagators/jaeger"
+	otel "go.opentelemetry.io/otel"
+	attribute "go.opentelemetry.io/otel/attribute"
+	otbridge "go.opentelemetry.io/otel/bridge/opentracing"
+	otlptracehttp "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	stdouttrace "go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	propagation "go.opentelemetry.io/otel/propagation"
+	resource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// OpenTelemetryConfig config for OpenTelemetry
+type OpenTelemetryConfig struct {
+	// ServiceName of the resource, default env OTEL_SERVICE_NAME
+	ServiceName string
+	// Endpoint of the OTLP/HTTP collector (host:port),
+	// leave it empty to disable the OTLP exporter
+	Endpoint string
+	// Insecure disable TLS for the OTLP exporter
+	Insecure bool
+	// Headers sent with every OTLP export request
+	Headers map[string]string
+	// Writer export spans as JSON lines, for local runs,
+	// e.g. os.Stdout or a file
+	Writer io.Writer
+	// Sampler default ParentBased(AlwaysSample)
+	Sampler sdktrace.Sampler
+}
+
+type tracerProviderCloser struct {
+	*sdktrace.TracerProvider
+}
+
+// Close flush pending spans and shutdown the tracer provider
+func (c *tracerProviderCloser) Close() error {
+	return c.Shutdown(context.Background())
+}
+
+// OpenTelemetry setup an OpenTelemetry tracer provider, and bridge
+// the opentracing global tracer to it, so that all spans created by
+// brick (and by your code through opentracing) are exported by OpenTelemetry.
+// It propagates W3C Trace Context, Baggage, Zipkin B3 and jaeger headers,
+// so traces continue across services that still use Jaeger.
+func OpenTelemetry(cfg *OpenTelemetryConfig) io.Closer {
+	name := cfg.ServiceName
+	if name == "" {
+		name = os.Getenv("OTEL_SERVICE_NAME")
+	}
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewSchemaless(attribute.String("service.name", name)),
+	)
+	if err != nil {
+		log.Panic().Err(err).Send()
+	}
+
+	sampler := cfg.Sampler
+	if sampler == nil {
+		sampler = sdktrace.ParentBased(sdktrace.AlwaysSample())
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+	}
+
+	if cfg.Endpoint != "" {
+		otlpOpts := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(cfg.Endpoint),
+		}
+		if cfg.Insecure {
+			otlpOpts = append(otlpOpts, otlptracehttp.WithInsecure())
+		}
+		if cfg.Headers != nil {
+			otlpOpts = append(otlpOpts, otlptracehttp.WithHeaders(cfg.Headers))
+		}
+		exporter, err := otlptracehttp.New(context.Background(), otlpOpts...)
+		if err != nil {
+			log.Panic().Err(err).Send()
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+
+	if cfg.Writer != nil {
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(cfg.Writer))
+		if err != nil {
+			log.Panic().Err(err).Send()
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+
+	provider := sdktrace.NewTracerProvider(opts...)
+
+	propagator := propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+		b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)),
+		jaegerprop.Jaeger{},
+	)
+
+	// spans created by opentracing and by opentelemetry
+	// share the same context through the bridge
+	bridge, wrapper := otbridge.NewTracerPair(provider.Tracer("github.com/pickjunk/brick"))
+	bridge.SetTextMapPropagator(propagator)
+	bridge.SetWarningHandler(func(msg string) {
+		log.Debug().Str("component", "brick.otel").Msg(msg)
+	})
+
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		log.Error().Str("component", "brick.otel").Err(err).Send()
+	}))
+	otel.SetTextMapPropagator(propagator)
+	otel.SetTracerProvider(wrapper)
+	ot.SetGlobalTracer(bridge)
+
+	return &tracerProviderCloser{provider}
+}
@@ -0,0 +1,52 @@
+package brick
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	ot "github.com/opentracing/opentracing-go"
+	assert "github.com/stretchr/testify/assert"
+	otel "go.opentelemetry.io/otel"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func TestOpenTelemetry(t *testing.T) {
+	origin := ot.GlobalTracer()
+	defer ot.SetGlobalTracer(origin)
+
+	var buf bytes.Buffer
+	closer := OpenTelemetry(&OpenTelemetryConfig{
+		ServiceName: "brick-test",
+		Writer:      &buf,
+	})
+
+	var traceID string
+	var nested oteltrace.SpanContext
+	r := New()
+	r.GET("/", func(ctx context.Context) {
+		traceID = Access(ctx)["trace_id"]
+
+		// opentelemetry spans nest under brick spans through the bridge
+		_, span := otel.Tracer("test").Start(ctx, "nested")
+		nested = span.SpanContext()
+		span.End()
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Uber-Trace-Id", "4bf92f3577b34da6a3ce929d0e0e4736:00f067aa0ba902b7:0:1")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Nil(t, closer.Close())
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID)
+	assert.Equal(t, traceID, nested.TraceID().String())
+	assert.Contains(t, buf.String(), `"Name":"http"`)
+	assert.Contains(t, buf.String(), `"Name":"nested"`)
+	assert.Contains(t, buf.String(), "brick-test")
+}
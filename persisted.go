@@ -0,0 +1,163 @@
+package brick
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+)
+
+// PersistedQueryStore store queries by their sha256 hash (hex)
+// for automatic persisted queries
+type PersistedQueryStore interface {
+	// Get return false if the hash is not found
+	Get(ctx context.Context, hash string) (string, bool, error)
+	Set(ctx context.Context, hash, query string) error
+}
+
+// PersistedQueryConfig config of persisted queries
+type PersistedQueryConfig struct {
+	// Store is an in-memory LRU of 1000 queries if nil
+	Store PersistedQueryStore
+	// AllowList reject queries not in the Store, and clients can not
+	// register new ones, queries must be registered ahead of time
+	AllowList bool
+}
+
+// default size of the in-memory LRU store
+const defaultPersistedQueries = 1000
+
+// PersistedQueries enable automatic persisted queries of the endpoint,
+// which are disabled by default:
+// clients send the sha256 hash of the query in the extensions as
+// {"persistedQuery":{"version":1,"sha256Hash":"..."}}, without the query,
+// and send both to register the query if PersistedQueryNotFound is returned
+func (g *Graphql) PersistedQueries(cfg *PersistedQueryConfig) *Graphql {
+	c := *cfg
+	if c.Store == nil {
+		c.Store = NewLRUQueryStore(defaultPersistedQueries)
+	}
+	g.persisted = &c
+	return g
+}
+
+// QueryHash return the sha256 hash (hex) of the query
+func QueryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// resolve fill the query of params from the store, or register
+// it, following the protocol of Apollo automatic persisted queries
+func (c *PersistedQueryConfig) resolve(ctx context.Context, params *graphqlParams) *graphqlRequestError {
+	var hash string
+	if pq, ok := params.Extensions["persistedQuery"].(map[string]interface{}); ok {
+		if version, _ := pq["version"].(float64); version != 1 {
+			return &graphqlRequestError{status: http.StatusBadRequest, message: "unsupported persisted query version"}
+		}
+		hash, _ = pq["sha256Hash"].(string)
+	}
+
+	if hash == "" {
+		if !c.AllowList || params.Query == "" {
+			return nil
+		}
+		hash = QueryHash(params.Query)
+	}
+
+	if params.Query != "" {
+		if QueryHash(params.Query) != hash {
+			return &graphqlRequestError{status: http.StatusBadRequest, message: "provided sha does not match query"}
+		}
+		if !c.AllowList {
+			if err := c.Store.Set(ctx, hash, params.Query); err != nil {
+				log.Error().Err(err).Msg("persisted query store")
+			}
+			return nil
+		}
+	}
+
+	query, ok, err := c.Store.Get(ctx, hash)
+	if err != nil {
+		log.Error().Err(err).Msg("persisted query store")
+		return &graphqlRequestError{status: http.StatusInternalServerError, message: "persisted query store unavailable"}
+	}
+	if !ok {
+		if c.AllowList {
+			return &graphqlRequestError{
+				status:  http.StatusForbidden,
+				message: "PersistedQueryNotAllowed",
+				code:    "PERSISTED_QUERY_NOT_ALLOWED",
+			}
+		}
+		// 200, as clients of Apollo expect, to retry with the query
+		return &graphqlRequestError{
+			status:  http.StatusOK,
+			message: "PersistedQueryNotFound",
+			code:    "PERSISTED_QUERY_NOT_FOUND",
+		}
+	}
+
+	params.Query = query
+	params.known = c.AllowList
+	return nil
+}
+
+// lruQueryStore in-memory PersistedQueryStore, evicting
+// the least recently used queries
+type lruQueryStore struct {
+	sync.Mutex
+	size    int
+	list    *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	hash  string
+	query string
+}
+
+// NewLRUQueryStore create an in-memory PersistedQueryStore of size queries
+func NewLRUQueryStore(size int) PersistedQueryStore {
+	if size <= 0 {
+		log.Panic().Msgf("expect a positive size, but get %d", size)
+	}
+
+	return &lruQueryStore{
+		size:    size,
+		list:    list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (s *lruQueryStore) Get(ctx context.Context, hash string) (string, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	e, ok := s.entries[hash]
+	if !ok {
+		return "", false, nil
+	}
+	s.list.MoveToFront(e)
+	return e.Value.(*lruEntry).query, true, nil
+}
+
+func (s *lruQueryStore) Set(ctx context.Context, hash, query string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if e, ok := s.entries[hash]; ok {
+		s.list.MoveToFront(e)
+		return nil
+	}
+
+	s.entries[hash] = s.list.PushFront(&lruEntry{hash, query})
+	if s.list.Len() > s.size {
+		oldest := s.list.Back()
+		s.list.Remove(oldest)
+		delete(s.entries, oldest.Value.(*lruEntry).hash)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package brick
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestLRUQueryStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewLRUQueryStore(2)
+
+	s.Set(ctx, "a", "A")
+	s.Set(ctx, "b", "B")
+	s.Get(ctx, "a")
+	s.Set(ctx, "c", "C")
+
+	_, ok, _ := s.Get(ctx, "b")
+	assert.False(t, ok)
+	q, ok, _ := s.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, "A", q)
+	q, ok, _ = s.Get(ctx, "c")
+	assert.True(t, ok)
+	assert.Equal(t, "C", q)
+}
+
+func apq(hash string) string {
+	return `{"persistedQuery":{"version":1,"sha256Hash":"` + hash + `"}}`
+}
+
+func TestPersistedQueries(t *testing.T) {
+	query := "{ greeting }"
+	hash := QueryHash(query)
+
+	// disabled by default
+	w := httptest.NewRecorder()
+	newRelayRouter().ServeHTTP(w, httptest.NewRequest("GET", "/graphql?"+url.Values{"extensions": {apq(hash)}}.Encode(), nil))
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "query is required")
+
+	g := NewGraphql(&relayResolver{})
+	g.Schema(`
+	type Query {
+		greeting(name: String): String!
+	}
+	`)
+	g.PersistedQueries(&PersistedQueryConfig{})
+	r := New()
+	r.Graphql("/graphql", g)
+
+	get := func(values url.Values) string {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/graphql?"+values.Encode(), nil))
+		assert.Equal(t, 200, w.Code)
+		return w.Body.String()
+	}
+
+	assert.Equal(
+		t,
+		`{"errors":[{"message":"PersistedQueryNotFound","extensions":{"code":"PERSISTED_QUERY_NOT_FOUND"}}]}`+"\n",
+		get(url.Values{"extensions": {apq(hash)}}),
+	)
+	assert.Equal(
+		t,
+		`{"data":{"greeting":"hello world"}}`,
+		get(url.Values{"query": {query}, "extensions": {apq(hash)}}),
+	)
+	assert.Equal(
+		t,
+		`{"data":{"greeting":"hello world"}}`,
+		get(url.Values{"extensions": {apq(hash)}}),
+	)
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/graphql", strings.NewReader(`{"query":"{ greeting }","extensions":`+apq("bad")+`}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "provided sha does not match query")
+}
+
+func TestPersistedQueriesAllowList(t *testing.T) {
+	ctx := context.Background()
+	store := NewLRUQueryStore(10)
+	store.Set(ctx, QueryHash("{ greeting }"), "{ greeting }")
+
+	g := NewGraphql(&relayResolver{})
+	g.Schema(`
+	type Query {
+		greeting(name: String): String!
+	}
+	`)
+	g.PersistedQueries(&PersistedQueryConfig{Store: store, AllowList: true})
+	r := New()
+	r.Graphql("/graphql", g)
+
+	cases := []struct {
+		values   url.Values
+		status   int
+		response string
+	}{
+		{url.Values{"query": {"{ greeting }"}}, 200, `{"data":{"greeting":"hello world"}}`},
+		{url.Values{"extensions": {apq(QueryHash("{ greeting }"))}}, 200, `{"data":{"greeting":"hello world"}}`},
+		{url.Values{"query": {`{ greeting(name: "x") }`}}, 403, "PERSISTED_QUERY_NOT_ALLOWED"},
+		{url.Values{
+			"query":      {`{ greeting(name: "x") }`},
+			"extensions": {apq(QueryHash(`{ greeting(name: "x") }`))},
+		}, 403, "PERSISTED_QUERY_NOT_ALLOWED"},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/graphql?"+c.values.Encode(), nil))
+		assert.Equal(t, c.status, w.Code, c.values.Encode())
+		assert.Contains(t, w.Body.String(), c.response, c.values.Encode())
+	}
+}
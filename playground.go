@@ -0,0 +1,135 @@
+package brick
+
+import (
+	"embed"
+	"encoding/json"
+	"html/template"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// PlaygroundConfig config of the playground page
+type PlaygroundConfig struct {
+	// Production serve the page even if ENV=production,
+	// where it is disabled by default
+	Production bool
+	// Headers pre-filled in the headers editor,
+	// e.g. {"Authorization": "Bearer "}
+	Headers map[string]string
+	// Title of the page, GraphQL Playground if empty
+	Title string
+}
+
+// Playground config the playground page, served to browsers (GET with
+// Accept: text/html) on the path of the endpoint, nil to disable it.
+// It is enabled by default, except when ENV=production
+func (g *Graphql) Playground(cfg *PlaygroundConfig) *Graphql {
+	if cfg == nil {
+		g.playground = nil
+		return g
+	}
+	c := *cfg
+	g.playground = &c
+	return g
+}
+
+// the page and its assets (scripts and styles) are embedded,
+// nothing is loaded from CDNs
+//
+//go:embed playground
+var playgroundFiles embed.FS
+
+var playgroundTemplate = template.Must(template.ParseFS(playgroundFiles, "playground/index.html"))
+
+// query param of assets of the page, served on the path of the endpoint,
+// e.g. /graphql?playground=playground.js
+const playgroundAssetParam = "playground"
+
+// playgroundEnabled return true if the playground can be served for r
+func (e *graphqlEndpoint) playgroundEnabled(r *http.Request) bool {
+	if e.playground == nil || r.Method != "GET" {
+		return false
+	}
+	return os.Getenv("ENV") != "production" || e.playground.Production
+}
+
+// acceptPlayground return true if the playground should be served
+func (e *graphqlEndpoint) acceptPlayground(r *http.Request) bool {
+	if !e.playgroundEnabled(r) {
+		return false
+	}
+
+	// browsers ask for text/html explicitly, */* is not enough,
+	// which is sent by curl and the like
+	accept := r.Header.Get("Accept")
+	explicit := false
+	for _, part := range strings.Split(accept, ",") {
+		if mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(part)); mediaType == "text/html" {
+			explicit = true
+			break
+		}
+	}
+	return explicit && negotiate(accept, append([]string{"text/html"}, graphqlMediaTypes...)...) == "text/html"
+}
+
+// servePlayground serve the page, the query, variables and operation name
+// in the url query are pre-filled, for links to the playground
+func (e *graphqlEndpoint) servePlayground(w http.ResponseWriter, r *http.Request) {
+	cfg := e.playground
+
+	title := cfg.Title
+	if title == "" {
+		title = "GraphQL Playground"
+	}
+	headers := cfg.Headers
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	headersJSON, _ := json.MarshalIndent(headers, "", "  ")
+
+	q := r.URL.Query()
+	data := map[string]interface{}{
+		"Title":         title,
+		"Endpoint":      r.URL.Path,
+		"Query":         q.Get("query"),
+		"Variables":     q.Get("variables"),
+		"OperationName": q.Get("operationName"),
+		"Headers":       string(headersJSON),
+		"Assets":        r.URL.Path + "?" + playgroundAssetParam + "=",
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := playgroundTemplate.Execute(w, data); err != nil {
+		log.Panic().Err(err).Send()
+	}
+}
+
+// servePlaygroundAsset serve an asset of the page, return false if r is
+// not for assets
+func (e *graphqlEndpoint) servePlaygroundAsset(w http.ResponseWriter, r *http.Request) bool {
+	if !e.playgroundEnabled(r) {
+		return false
+	}
+	name := r.URL.Query().Get(playgroundAssetParam)
+	if name == "" {
+		return false
+	}
+
+	// the page is a template, not an asset
+	name = path.Clean("/" + name)[1:]
+	data, err := fs.ReadFile(playgroundFiles, "playground/"+name)
+	if err != nil || name == "index.html" {
+		http.NotFound(w, r)
+		return true
+	}
+
+	w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(name)))
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(data)
+	return true
+}
@@ -0,0 +1,241 @@
+(function () {
+  // set by the page
+  var endpoint = window.brickPlayground.endpoint;
+  var initial = window.brickPlayground.initial;
+
+  var $ = function (id) { return document.getElementById(id); };
+  var editors = { query: $('query'), variables: $('variables'), headers: $('headers'), operationName: $('operation') };
+  var storageKey = 'brick.playground:' + endpoint;
+
+  $('endpoint').textContent = endpoint;
+
+  // the url query wins, then what was left in the last visit,
+  // headers fall back to the pre-filled ones of the server
+  var saved = {};
+  try { saved = JSON.parse(localStorage.getItem(storageKey)) || {}; } catch (e) {}
+  Object.keys(editors).forEach(function (name) {
+    var v = initial[name] && name !== 'headers' ? initial[name] : saved[name];
+    if (v === undefined || v === '') v = name === 'headers' ? initial.headers : '';
+    editors[name].value = v;
+    editors[name].addEventListener('input', save);
+  });
+
+  function save() {
+    var state = {};
+    Object.keys(editors).forEach(function (name) { state[name] = editors[name].value; });
+    try { localStorage.setItem(storageKey, JSON.stringify(state)); } catch (e) {}
+  }
+
+  function parseJSON(name) {
+    var text = editors[name].value.trim();
+    if (!text) return {};
+    try {
+      return JSON.parse(text);
+    } catch (e) {
+      throw new Error(name + ' must be a JSON object: ' + e.message);
+    }
+  }
+
+  function setStatus(text, error) {
+    $('status').textContent = text;
+    $('status').className = error ? 'status error' : 'status';
+  }
+
+  function request(body) {
+    var headers = parseJSON('headers');
+    headers['Content-Type'] = 'application/json';
+    headers['Accept'] = 'application/graphql-response+json, application/json';
+    return fetch(endpoint, {
+      method: 'POST',
+      headers: headers,
+      credentials: 'same-origin',
+      body: JSON.stringify(body)
+    });
+  }
+
+  function run() {
+    var body;
+    try {
+      body = { query: editors.query.value, variables: parseJSON('variables') };
+    } catch (e) {
+      setStatus(e.message, true);
+      return;
+    }
+    if (editors.operationName.value.trim()) body.operationName = editors.operationName.value.trim();
+
+    var start = Date.now();
+    $('run').disabled = true;
+    setStatus('Running...');
+    request(body).then(function (res) {
+      return res.text().then(function (text) {
+        var ms = Date.now() - start;
+        setStatus(res.status + ' ' + res.statusText + ' · ' + ms + 'ms', !res.ok);
+        try {
+          $('output').textContent = JSON.stringify(JSON.parse(text), null, 2);
+        } catch (e) {
+          $('output').textContent = text;
+        }
+      });
+    }).catch(function (e) {
+      setStatus(e.message, true);
+    }).then(function () {
+      $('run').disabled = false;
+    });
+  }
+
+  $('run').addEventListener('click', run);
+  document.addEventListener('keydown', function (e) {
+    if (e.key === 'Enter' && (e.ctrlKey || e.metaKey)) {
+      e.preventDefault();
+      run();
+    }
+  });
+
+  // tab inserts 2 spaces in editors
+  ['query', 'variables', 'headers'].forEach(function (name) {
+    var el = editors[name];
+    el.addEventListener('keydown', function (e) {
+      if (e.key !== 'Tab' || e.shiftKey) return;
+      e.preventDefault();
+      var s = el.selectionStart;
+      el.value = el.value.slice(0, s) + '  ' + el.value.slice(el.selectionEnd);
+      el.selectionStart = el.selectionEnd = s + 2;
+      save();
+    });
+  });
+
+  Array.prototype.forEach.call(document.querySelectorAll('.tabs button'), function (button) {
+    button.addEventListener('click', function () {
+      Array.prototype.forEach.call(document.querySelectorAll('.tabs button'), function (b) {
+        b.classList.toggle('active', b === button);
+        $(b.getAttribute('data-tab')).hidden = b !== button;
+      });
+    });
+  });
+
+  // docs, by introspection
+  var introspection = '{ __schema { queryType { name } mutationType { name } subscriptionType { name } ' +
+    'types { kind name description ' +
+    'fields { name description args { name type { ...T } defaultValue } type { ...T } isDeprecated deprecationReason } ' +
+    'inputFields { name description type { ...T } defaultValue } ' +
+    'interfaces { name } possibleTypes { name } enumValues { name description } } } } ' +
+    'fragment T on __Type { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name } } } } }';
+  var schema = null;
+  var history = [];
+
+  function typeName(t) {
+    if (t.kind === 'NON_NULL') return typeName(t.ofType) + '!';
+    if (t.kind === 'LIST') return '[' + typeName(t.ofType) + ']';
+    return t.name;
+  }
+  function namedType(t) {
+    return t.ofType ? namedType(t.ofType) : t.name;
+  }
+  function el(tag, cls, text) {
+    var e = document.createElement(tag);
+    if (cls) e.className = cls;
+    if (text !== undefined) e.textContent = text;
+    return e;
+  }
+  function typeLink(t) {
+    var a = el('a', '', typeName(t));
+    a.addEventListener('click', function () { showType(namedType(t), true); });
+    return a;
+  }
+
+  function showRoots() {
+    var docs = $('docs');
+    docs.textContent = '';
+    history = [];
+    docs.appendChild(el('h2', '', 'Root types'));
+    var ul = el('ul');
+    [['query', schema.queryType], ['mutation', schema.mutationType], ['subscription', schema.subscriptionType]].forEach(function (r) {
+      if (!r[1]) return;
+      var li = el('li');
+      li.appendChild(el('span', 'field', r[0] + ': '));
+      li.appendChild(typeLink({ kind: 'OBJECT', name: r[1].name }));
+      ul.appendChild(li);
+    });
+    docs.appendChild(ul);
+
+    docs.appendChild(el('h2', '', 'All types'));
+    ul = el('ul');
+    schema.types.forEach(function (t) {
+      if (t.name.indexOf('__') === 0) return;
+      var li = el('li');
+      li.appendChild(typeLink(t));
+      ul.appendChild(li);
+    });
+    docs.appendChild(ul);
+  }
+
+  function showType(name, push) {
+    var t = schema.types.filter(function (t) { return t.name === name; })[0];
+    if (!t) return;
+    if (push) history.push(name);
+
+    var docs = $('docs');
+    docs.textContent = '';
+    var back = el('a', 'back', '← back');
+    back.addEventListener('click', function () {
+      history.pop();
+      if (history.length) showType(history[history.length - 1], false);
+      else showRoots();
+    });
+    docs.appendChild(back);
+    docs.appendChild(el('h2', '', t.kind.toLowerCase().replace('_', ' ') + ' ' + t.name));
+    if (t.description) docs.appendChild(el('p', '', t.description));
+
+    var ul = el('ul');
+    (t.fields || t.inputFields || []).forEach(function (f) {
+      var li = el('li');
+      li.appendChild(el('span', 'field', f.name));
+      if (f.args && f.args.length) {
+        li.appendChild(document.createTextNode('('));
+        f.args.forEach(function (a, i) {
+          if (i) li.appendChild(document.createTextNode(', '));
+          li.appendChild(el('span', 'arg', a.name + ': '));
+          li.appendChild(typeLink(a.type));
+          if (a.defaultValue !== null) li.appendChild(document.createTextNode(' = ' + a.defaultValue));
+        });
+        li.appendChild(document.createTextNode(')'));
+      }
+      li.appendChild(document.createTextNode(': '));
+      li.appendChild(typeLink(f.type));
+      if (f.isDeprecated) li.appendChild(el('span', 'arg', ' deprecated' + (f.deprecationReason ? ': ' + f.deprecationReason : '')));
+      if (f.description) li.appendChild(el('p', '', f.description));
+      ul.appendChild(li);
+    });
+    (t.enumValues || []).forEach(function (v) {
+      var li = el('li', 'field', v.name);
+      if (v.description) li.appendChild(el('p', '', v.description));
+      ul.appendChild(li);
+    });
+    (t.possibleTypes || []).forEach(function (p) {
+      var li = el('li');
+      li.appendChild(typeLink({ kind: 'OBJECT', name: p.name }));
+      ul.appendChild(li);
+    });
+    docs.appendChild(ul);
+  }
+
+  $('toggle-docs').addEventListener('click', function () {
+    var docs = $('docs');
+    docs.hidden = !docs.hidden;
+    if (docs.hidden || schema) return;
+
+    docs.textContent = 'Loading...';
+    try {
+      // headers are parsed synchronously
+      request({ query: introspection }).then(function (res) { return res.json(); }).then(function (result) {
+        if (!result.data) throw new Error(result.errors ? result.errors[0].message : 'introspection failed');
+        schema = result.data.__schema;
+        showRoots();
+      }).catch(function (e) {
+        docs.textContent = e.message;
+      });
+    } catch (e) {
+      docs.textContent = e.message;
+    }
+  });
+})();
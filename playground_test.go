@@ -0,0 +1,88 @@
+package brick
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestPlayground(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGraphql(&relayResolver{})
+	g.Schema(`
+	type Query {
+		greeting(name: String): String!
+	}
+	`)
+	g.Playground(&PlaygroundConfig{
+		Headers: map[string]string{"Authorization": "Bearer "},
+	})
+	r := New()
+	r.Graphql("/graphql", g)
+
+	get := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/graphql?query="+url.QueryEscape("{ greeting }"), nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// browsers
+	w := get("text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	assert.Equal(200, w.Code)
+	assert.Equal("text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	assert.Contains(body, "<title>GraphQL Playground</title>")
+	assert.Contains(body, `endpoint: "/graphql",`)
+	assert.Contains(body, `query: "{ greeting }",`)
+	assert.Contains(body, `headers: "{\n  \"Authorization\": \"Bearer \"\n}"`)
+
+	// assets are embedded, nothing is loaded from CDNs
+	assert.Contains(body, `<script src="/graphql?playground=playground.js"></script>`)
+	assert.Contains(body, `<link rel="stylesheet" href="/graphql?playground=playground.css">`)
+	asset := func(name string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/graphql?playground="+url.QueryEscape(name), nil))
+		return w
+	}
+	w = asset("playground.js")
+	assert.Equal(200, w.Code)
+	assert.Equal("text/javascript; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(w.Body.String(), "window.brickPlayground")
+	w = asset("playground.css")
+	assert.Equal("text/css; charset=utf-8", w.Header().Get("Content-Type"))
+	for _, name := range []string{"index.html", "../playground.go", "missing.js"} {
+		assert.Equal(404, asset(name).Code, name)
+	}
+
+	// clients of GraphQL
+	for _, accept := range []string{"", "*/*", "application/json", "application/json, text/html;q=0.5"} {
+		w = get(accept)
+		assert.Equal(`{"data":{"greeting":"hello world"}}`, w.Body.String(), accept)
+	}
+
+	// disabled in production, unless enabled explicitly
+	os.Setenv("ENV", "production")
+	defer os.Unsetenv("ENV")
+	w = get("text/html")
+	assert.Equal(406, w.Code)
+	assert.Equal(400, asset("playground.js").Code)
+	w = get("text/html, application/json;q=0.9")
+	assert.Equal(`{"data":{"greeting":"hello world"}}`, w.Body.String())
+
+	g.Playground(&PlaygroundConfig{Production: true})
+	w = get("text/html")
+	assert.Equal("text/html; charset=utf-8", w.Header().Get("Content-Type"))
+
+	g.Playground(nil)
+	os.Unsetenv("ENV")
+	w = get("text/html, application/json;q=0.9")
+	assert.Equal(`{"data":{"greeting":"hello world"}}`, w.Body.String())
+}
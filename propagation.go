@@ -0,0 +1,155 @@
+package brick
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	ot "github.com/opentracing/opentracing-go"
+	jaeger "github.com/uber/jaeger-client-go"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+type traceFormat string
+
+const (
+	// TraceContextHTTPHeaders is the W3C Trace Context (traceparent header)
+	// format, registered to the tracer created by Jaeger
+	TraceContextHTTPHeaders traceFormat = "w3c-trace-context"
+	// B3HTTPHeaders is the Zipkin B3 (x-b3-* headers) format,
+	// registered to the tracer created by Jaeger
+	B3HTTPHeaders traceFormat = "zipkin-b3"
+)
+
+// traceFormats are tried in order when extracting span context
+// from incoming http headers
+var traceFormats = []interface{}{
+	ot.HTTPHeaders,
+	TraceContextHTTPHeaders,
+	B3HTTPHeaders,
+}
+
+// extractSpanContext extract the parent span context from http headers,
+// return ot.ErrSpanContextNotFound if none of the formats matches
+func extractSpanContext(tracer ot.Tracer, h http.Header) (ot.SpanContext, error) {
+	for _, format := range traceFormats {
+		sc, err := tracer.Extract(format, ot.HTTPHeadersCarrier(h))
+		switch err {
+		case nil:
+			return sc, nil
+		case ot.ErrSpanContextNotFound, ot.ErrUnsupportedFormat:
+			continue
+		default:
+			return nil, err
+		}
+	}
+	return nil, ot.ErrSpanContextNotFound
+}
+
+// InjectHTTPHeaders inject the span context into outgoing http headers,
+// in every format supported by the global tracer
+func InjectHTTPHeaders(sc ot.SpanContext, h http.Header) {
+	tracer := ot.GlobalTracer()
+	for _, format := range traceFormats {
+		err := tracer.Inject(sc, format, ot.HTTPHeadersCarrier(h))
+		if err != nil && err != ot.ErrUnsupportedFormat {
+			log.Debug().Err(err).Msg("inject span context")
+		}
+	}
+}
+
+// traceID of a span, empty if the tracer is neither jaeger nor opentelemetry
+func traceID(span ot.Span) string {
+	switch sc := span.Context().(type) {
+	case jaeger.SpanContext:
+		return sc.TraceID().String()
+	case interface{ TraceID() oteltrace.TraceID }:
+		// opentelemetry bridge
+		if id := sc.TraceID(); id.IsValid() {
+			return id.String()
+		}
+	}
+	return ""
+}
+
+// traceContextPropagator implements jaeger.Injector and jaeger.Extractor
+// for W3C Trace Context
+// https://www.w3.org/TR/trace-context/#traceparent-header
+type traceContextPropagator struct{}
+
+const traceparentHeader = "traceparent"
+
+func (p traceContextPropagator) Inject(sc jaeger.SpanContext, abstractCarrier interface{}) error {
+	carrier, ok := abstractCarrier.(ot.TextMapWriter)
+	if !ok {
+		return ot.ErrInvalidCarrier
+	}
+
+	flags := 0
+	if sc.IsSampled() {
+		flags = 1
+	}
+	traceID := sc.TraceID()
+	carrier.Set(traceparentHeader, fmt.Sprintf(
+		"00-%016x%016x-%016x-%02x",
+		traceID.High,
+		traceID.Low,
+		uint64(sc.SpanID()),
+		flags,
+	))
+	return nil
+}
+
+func (p traceContextPropagator) Extract(abstractCarrier interface{}) (jaeger.SpanContext, error) {
+	carrier, ok := abstractCarrier.(ot.TextMapReader)
+	if !ok {
+		return jaeger.SpanContext{}, ot.ErrInvalidCarrier
+	}
+
+	var traceparent string
+	carrier.ForeachKey(func(key, value string) error {
+		if strings.ToLower(key) == traceparentHeader {
+			traceparent = value
+		}
+		return nil
+	})
+	if traceparent == "" {
+		return jaeger.SpanContext{}, ot.ErrSpanContextNotFound
+	}
+
+	// version-traceid-parentid-flags
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 ||
+		len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 ||
+		len(parts[2]) != 16 ||
+		len(parts[3]) != 2 {
+		return jaeger.SpanContext{}, ot.ErrSpanContextCorrupted
+	}
+	// version 00 has exactly 4 parts
+	if parts[0] == "00" && len(parts) != 4 {
+		return jaeger.SpanContext{}, ot.ErrSpanContextCorrupted
+	}
+
+	traceID, err := jaeger.TraceIDFromString(parts[1])
+	if err != nil || !traceID.IsValid() {
+		return jaeger.SpanContext{}, ot.ErrSpanContextCorrupted
+	}
+	spanID, err := strconv.ParseUint(parts[2], 16, 64)
+	if err != nil || spanID == 0 {
+		return jaeger.SpanContext{}, ot.ErrSpanContextCorrupted
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return jaeger.SpanContext{}, ot.ErrSpanContextCorrupted
+	}
+
+	return jaeger.NewSpanContext(
+		traceID,
+		jaeger.SpanID(spanID),
+		0,
+		flags&1 == 1,
+		nil,
+	), nil
+}
@@ -0,0 +1,85 @@
+package brick
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ot "github.com/opentracing/opentracing-go"
+	assert "github.com/stretchr/testify/assert"
+	jaeger "github.com/uber/jaeger-client-go"
+	zipkin "github.com/uber/jaeger-client-go/zipkin"
+)
+
+func TestTraceContextPropagator(t *testing.T) {
+	p := traceContextPropagator{}
+
+	h := http.Header{}
+	h.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	sc, err := p.Extract(ot.HTTPHeadersCarrier(h))
+	assert.Nil(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+	assert.Equal(t, "f067aa0ba902b7", sc.SpanID().String())
+	assert.True(t, sc.IsSampled())
+
+	out := http.Header{}
+	assert.Nil(t, p.Inject(sc, ot.HTTPHeadersCarrier(out)))
+	assert.Equal(t, h.Get("Traceparent"), out.Get("Traceparent"))
+
+	_, err = p.Extract(ot.HTTPHeadersCarrier(http.Header{}))
+	assert.Equal(t, ot.ErrSpanContextNotFound, err)
+
+	h.Set("Traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	_, err = p.Extract(ot.HTTPHeadersCarrier(h))
+	assert.Equal(t, ot.ErrSpanContextCorrupted, err)
+}
+
+func TestLogMiddlewareExtract(t *testing.T) {
+	b3 := zipkin.NewZipkinB3HTTPHeaderPropagator()
+	w3c := traceContextPropagator{}
+	reporter := jaeger.NewInMemoryReporter()
+	tracer, closer := jaeger.NewTracer(
+		"brick-test",
+		jaeger.NewConstSampler(true),
+		reporter,
+		jaeger.TracerOptions.Injector(B3HTTPHeaders, b3),
+		jaeger.TracerOptions.Extractor(B3HTTPHeaders, b3),
+		jaeger.TracerOptions.Injector(TraceContextHTTPHeaders, w3c),
+		jaeger.TracerOptions.Extractor(TraceContextHTTPHeaders, w3c),
+	)
+	defer closer.Close()
+
+	origin := ot.GlobalTracer()
+	ot.SetGlobalTracer(tracer)
+	defer ot.SetGlobalTracer(origin)
+
+	var traceIDs []string
+	r := New()
+	r.GET("/", func(ctx context.Context) {
+		traceIDs = append(traceIDs, Access(ctx)["trace_id"])
+	})
+
+	headers := []map[string]string{
+		{"Uber-Trace-Id": "abc:1:0:1"},
+		{"Traceparent": "00-00000000000000000000000000000abc-0000000000000001-01"},
+		{"X-B3-Traceid": "abc", "X-B3-Spanid": "1", "X-B3-Sampled": "1"},
+	}
+	for _, h := range headers {
+		req := httptest.NewRequest("GET", "/", nil)
+		for k, v := range h {
+			req.Header.Set(k, v)
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, []string{"abc", "abc", "abc"}, traceIDs)
+	for _, span := range reporter.GetSpans() {
+		assert.Equal(t, jaeger.SpanID(1), span.Context().(jaeger.SpanContext).ParentID())
+	}
+
+	// start a new root span without upstream headers
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.NotEqual(t, "abc", traceIDs[3])
+	assert.NotEqual(t, "", traceIDs[3])
+}
@@ -21,6 +21,12 @@ func recoverMiddleware(ctx context.Context, next Handle) {
 				// just response it here
 				w.Write([]byte(t.Error()))
 				return
+			case *BindError:
+				// bad input, respond 400 with the details
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(t.Error()))
+				return
 			case string:
 				if t != "" {
 					err = errors.New(t)
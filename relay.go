@@ -1,17 +1,29 @@
 package brick
 
 import (
+	"bytes"
 	"context"
 	"crypto/md5"
 	"encoding/json"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
 	"strings"
 	"errors"
+	"time"
 
+	websocket "github.com/gorilla/websocket"
 	graphql "github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	ot "github.com/opentracing/opentracing-go"
+	otext "github.com/opentracing/opentracing-go/ext"
+	be "github.com/pickjunk/brick/error"
+	bm "github.com/pickjunk/brick/metrics"
+	ast "github.com/vektah/gqlparser/v2/ast"
 )
 
 // fork from github.com/graph-gophers/graphql-go/relay
@@ -24,21 +36,295 @@ func formatSchema(schema string) string {
 	return r
 }
 
-func relay(ctx context.Context, schema *graphql.Schema) {
+// graphqlParams of a GraphQL-over-HTTP request
+type graphqlParams struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	Extensions    map[string]interface{} `json:"extensions"`
+	// parsed query, nil if it is invalid
+	doc *ast.QueryDocument
+	// the query is of the allow list of persisted queries
+	known bool
+}
+
+// graphqlRequestError is a bad request, rejected before execution
+type graphqlRequestError struct {
+	status  int
+	message string
+	// Allow header of 405
+	allow string
+	// code in the extensions of the error
+	code string
+}
+
+// media types of GraphQL responses, application/json is preferred
+// for wildcards to be compatible with legacy clients
+var graphqlMediaTypes = []string{
+	"application/json",
+	"application/graphql-response+json",
+}
+
+// parseGraphqlParams parse the params of GET requests from the url query,
+// of POST requests from the application/json or application/graphql body,
+// batch is true if the body is a JSON array of params. Either the query or
+// the body is limited to maxBytes, unless it is 0
+func parseGraphqlParams(w http.ResponseWriter, r *http.Request, maxBytes int64) (list []*graphqlParams, batch bool, reqErr *graphqlRequestError) {
+	params := &graphqlParams{}
+	tooLarge := &graphqlRequestError{
+		status:  http.StatusRequestEntityTooLarge,
+		message: fmt.Sprintf("request exceeds the limit of %d bytes", maxBytes),
+		code:    "QUERY_TOO_LARGE",
+	}
+	readBody := func() ([]byte, *graphqlRequestError) {
+		body := r.Body
+		if maxBytes > 0 {
+			body = http.MaxBytesReader(w, r.Body, maxBytes)
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				return nil, tooLarge
+			}
+			return nil, &graphqlRequestError{status: http.StatusBadRequest, message: err.Error()}
+		}
+		return data, nil
+	}
+
+	switch r.Method {
+	case "GET":
+		if maxBytes > 0 && int64(len(r.URL.RawQuery)) > maxBytes {
+			tooLarge.status = http.StatusRequestURITooLong
+			return nil, false, tooLarge
+		}
+		if err := parseGraphqlQuery(r.URL.Query(), params); err != nil {
+			return nil, false, err
+		}
+	case "POST":
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch contentType {
+		// without Content-Type, JSON is assumed for legacy clients
+		case "application/json", "":
+			body, err := readBody()
+			if err != nil {
+				return nil, false, err
+			}
+			if b := bytes.TrimSpace(body); len(b) > 0 && b[0] == '[' {
+				if err := json.Unmarshal(b, &list); err != nil {
+					return nil, false, &graphqlRequestError{status: http.StatusBadRequest, message: "invalid JSON body: " + err.Error()}
+				}
+				if len(list) == 0 {
+					return nil, false, &graphqlRequestError{status: http.StatusBadRequest, message: "empty batch"}
+				}
+				for i, params := range list {
+					if params == nil {
+						list[i] = &graphqlParams{}
+					}
+				}
+				return list, true, nil
+			}
+			if err := json.Unmarshal(body, params); err != nil {
+				return nil, false, &graphqlRequestError{status: http.StatusBadRequest, message: "invalid JSON body: " + err.Error()}
+			}
+		case "application/graphql":
+			body, err := readBody()
+			if err != nil {
+				return nil, false, err
+			}
+			if err := parseGraphqlQuery(r.URL.Query(), params); err != nil {
+				return nil, false, err
+			}
+			params.Query = string(body)
+		default:
+			return nil, false, &graphqlRequestError{status: http.StatusUnsupportedMediaType, message: "unsupported Content-Type " + contentType}
+		}
+	default:
+		return nil, false, &graphqlRequestError{status: http.StatusMethodNotAllowed, message: "method " + r.Method + " not allowed", allow: "GET, POST"}
+	}
+
+	return []*graphqlParams{params}, false, nil
+}
+
+// checkGraphqlParams check params after persisted queries are resolved,
+// stream is true if the response is a stream of server-sent events
+func checkGraphqlParams(r *http.Request, params *graphqlParams, stream bool) *graphqlRequestError {
+	if params.Query == "" {
+		return &graphqlRequestError{status: http.StatusBadRequest, message: "query is required"}
+	}
+
+	op := operationType(params.doc, params.OperationName)
+
+	// only queries (and subscriptions of streams) are allowed by GET,
+	// to be safe for caches and crawlers
+	if r.Method == "GET" && op == ast.Mutation {
+		return &graphqlRequestError{status: http.StatusMethodNotAllowed, message: "only queries are allowed by GET", allow: "POST"}
+	}
+
+	if op == ast.Subscription && !stream {
+		return &graphqlRequestError{status: http.StatusBadRequest, message: "subscriptions require WebSocket or Accept: text/event-stream"}
+	}
+
+	return nil
+}
+
+// acceptEventStream return true if the client asks for server-sent events
+func acceptEventStream(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(part))
+		if mediaType == "text/event-stream" {
+			return true
+		}
+	}
+	return false
+}
+
+func parseGraphqlQuery(q url.Values, params *graphqlParams) *graphqlRequestError {
+	params.Query = q.Get("query")
+	params.OperationName = q.Get("operationName")
+	if v := q.Get("variables"); v != "" {
+		if err := json.Unmarshal([]byte(v), &params.Variables); err != nil {
+			return &graphqlRequestError{status: http.StatusBadRequest, message: "variables must be a JSON object"}
+		}
+	}
+	if v := q.Get("extensions"); v != "" {
+		if err := json.Unmarshal([]byte(v), &params.Extensions); err != nil {
+			return &graphqlRequestError{status: http.StatusBadRequest, message: "extensions must be a JSON object"}
+		}
+	}
+	return nil
+}
+
+// operationType of the operation to execute, query if it can not be
+// determined, in which case the error is reported by the execution
+func operationType(doc *ast.QueryDocument, operationName string) ast.Operation {
+	if doc == nil {
+		return ast.Query
+	}
+	for _, op := range doc.Operations {
+		if op.Name == operationName || len(doc.Operations) == 1 {
+			return op.Operation
+		}
+	}
+	return ast.Query
+}
+
+// response of the error, for clients expecting a GraphQL response
+func (err *graphqlRequestError) response() *graphql.Response {
+	e := &gqlerrors.QueryError{Message: err.message}
+	if err.code != "" {
+		e.Extensions = map[string]interface{}{"code": err.code}
+	}
+	return &graphql.Response{Errors: []*gqlerrors.QueryError{e}}
+}
+
+func writeGraphqlError(w http.ResponseWriter, mediaType string, err *graphqlRequestError) {
+	if err.allow != "" {
+		w.Header().Set("Allow", err.allow)
+	}
+	w.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+	w.WriteHeader(err.status)
+	json.NewEncoder(w).Encode(err.response())
+}
+
+func (e *graphqlEndpoint) relay(ctx context.Context) {
 	w := Response(ctx)
 	r := Request(ctx)
 
-	var params struct {
-		Query         string                 `json:"query"`
-		OperationName string                 `json:"operationName"`
-		Variables     map[string]interface{} `json:"variables"`
+	if websocket.IsWebSocketUpgrade(r) {
+		e.serveWebSocket(ctx)
+		return
+	}
+	if e.servePlaygroundAsset(w, r) {
+		return
+	}
+	if e.acceptPlayground(r) {
+		e.servePlayground(w, r)
+		return
+	}
+	stream := acceptEventStream(r)
+
+	mediaType := negotiate(r.Header.Get("Accept"), graphqlMediaTypes...)
+	if stream {
+		// for errors before the stream starts
+		mediaType = "application/json"
+	}
+	if mediaType == "" {
+		http.Error(w, "Not Acceptable", http.StatusNotAcceptable)
+		return
+	}
+
+	list, batch, reqErr := parseGraphqlParams(w, r, e.limits.maxRequestBytes())
+	if reqErr == nil && batch {
+		reqErr = e.checkBatch(list, stream)
 	}
-	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+	if reqErr != nil {
+		writeGraphqlError(w, mediaType, reqErr)
 		return
 	}
 
-	access := Access(ctx)
+	if batch {
+		e.serveBatch(ctx, mediaType, list)
+		return
+	}
+
+	params := list[0]
+	if reqErr := e.prepare(ctx, params, stream, Access(ctx)); reqErr != nil {
+		writeGraphqlError(w, mediaType, reqErr)
+		return
+	}
+
+	if stream {
+		setGraphqlAccess(Access(ctx), params)
+		e.serveEventStream(ctx, params)
+		return
+	}
+
+	response, is500 := e.execute(ctx, params, Access(ctx))
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		log.Panic().Err(err).Send()
+	}
+
+	// GraphQL-over-HTTP: with application/graphql-response+json, 400 if
+	// the request is rejected before execution (no data), else 200,
+	// with application/json, 200, but 500 on internal errors as before
+	status := http.StatusOK
+	if mediaType == "application/graphql-response+json" {
+		if response.Data == nil {
+			status = http.StatusBadRequest
+		}
+	} else if is500 {
+		status = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(responseJSON)
+}
+
+// prepare resolve persisted queries and check params before execution
+func (e *graphqlEndpoint) prepare(ctx context.Context, params *graphqlParams, stream bool, access map[string]string) *graphqlRequestError {
+	if e.persisted != nil {
+		if reqErr := e.persisted.resolve(ctx, params); reqErr != nil {
+			return reqErr
+		}
+	}
+	if reqErr := e.limitSize(params, access); reqErr != nil {
+		return reqErr
+	}
+	if params.Query != "" {
+		e.parse(ctx, params)
+	}
+	if reqErr := checkGraphqlParams(Request(ctx), params, stream); reqErr != nil {
+		return reqErr
+	}
+	return e.limit(params, access)
+}
+
+// setGraphqlAccess add the query and operation name to the access log
+func setGraphqlAccess(access map[string]string, params *graphqlParams) {
 	access["schema"] = formatSchema(params.Query)
 	if os.Getenv("ENV") == "production" {
 		access["schema_hash"] = fmt.Sprintf("%x", md5.Sum([]byte(access["schema"])))
@@ -46,56 +332,135 @@ func relay(ctx context.Context, schema *graphql.Schema) {
 	if params.OperationName != "" {
 		access["operation"] = params.OperationName
 	}
+}
+
+// execute the operation of params, with a span and metrics,
+// return true if there are internal errors
+func (e *graphqlEndpoint) execute(ctx context.Context, params *graphqlParams, access map[string]string) (*graphql.Response, bool) {
+	setGraphqlAccess(access, params)
+
+	span, ctx := ot.StartSpanFromContext(ctx, "graphql")
+	defer span.Finish()
+	if params.OperationName != "" {
+		span.SetTag("graphql.operation", params.OperationName)
+	}
 
-	response := schema.Exec(ctx, params.Query, params.OperationName, params.Variables)
+	if e.limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.limits.Timeout)
+		defer cancel()
+	}
 
+	start := time.Now()
+	var v *validation
+	if e.tracing != nil {
+		v = &validation{start: start}
+		ctx = withValue(ctx, "graphql_validation", v)
+	}
+	response := e.schema.Exec(ctx, params.Query, params.OperationName, params.Variables)
+	duration := time.Now().Sub(start)
+	// rejected before execution
+	v.finish(ctx, response.Errors)
+
+	if ctx.Err() == context.DeadlineExceeded {
+		access["timeout"] = e.limits.Timeout.String()
+		response.Errors = append(response.Errors, &gqlerrors.QueryError{
+			Message:    "execution timeout",
+			Extensions: map[string]interface{}{"code": "TIMEOUT"},
+		})
+	}
+
+	is500 := e.maskErrors(response)
+
+	if is500 {
+		otext.Error.Set(span, true)
+	}
+
+	operation := e.operations.label(params)
+	result := "ok"
+	if len(response.Errors) > 0 {
+		result = "error"
+	}
+	bm.GraphqlOperations.WithLabelValues(operation, result).Inc()
+	bm.GraphqlDuration.WithLabelValues(operation, result).Observe(duration.Seconds())
+
+	return response, is500
+}
+
+// prefix of messages of recovered panics
+const panicMsg = "graphql: panic occurred: "
+
+// businessError of the graphql error, returned by the resolver,
+// or thrown by error.Throw, nil if it is not a business error
+func businessError(err *gqlerrors.QueryError) *be.BusinessError {
+	var bErr *be.BusinessError
+	if errors.As(err.ResolverError, &bErr) {
+		return bErr
+	}
+	var v be.BusinessError
+	if errors.As(err.ResolverError, &v) {
+		return &v
+	}
+
+	// panics are recovered by graphql-go, with the message only
+	if strings.HasPrefix(err.Message, panicMsg) {
+		dec := json.NewDecoder(strings.NewReader(strings.TrimPrefix(err.Message, panicMsg)))
+		dec.DisallowUnknownFields()
+		v = be.BusinessError{}
+		if dec.Decode(&v) == nil && !dec.More() {
+			return &v
+		}
+	}
+	return nil
+}
+
+// maskErrors put the code of business errors in extensions, mask
+// panics, and log internal errors, return true if there is any of them
+func (e *graphqlEndpoint) maskErrors(response *graphql.Response) bool {
 	is500 := false
 	errorMsg := []string{}
 
 	// https://github.com/graph-gophers/graphql-go/pull/207
-	if response.Errors != nil {
-		re := regexp.MustCompile(`{"code":\d+,"msg":".*?"}`)
-		panicMsg := "graphql: panic occurred: "
-
-		for _, rErr := range response.Errors {
-			// extract business error
-			if errMsg := re.FindString(rErr.Message); errMsg != "" {
-				rErr.Message = errMsg
-				continue
+	for _, rErr := range response.Errors {
+		if bErr := businessError(rErr); bErr != nil {
+			if rErr.Extensions == nil {
+				rErr.Extensions = make(map[string]interface{})
+			}
+			for k, v := range bErr.Extensions() {
+				rErr.Extensions[k] = v
+			}
+			if e.legacyErrors {
+				rErr.Message = bErr.Error()
+			} else {
+				rErr.Message = bErr.Msg
 			}
+			continue
+		}
 
+		// errors without data are request errors (syntax, validation),
+		// caused by clients
+		if response.Data != nil {
 			is500 = true
+		}
 
-			// handle panic error
-			if strings.Contains(rErr.Message, panicMsg) {
-				// only log panic msg if it is not empty
-				if rErr.Message != panicMsg {
-					errMsg := rErr.Message
-					errorMsg = append(errorMsg, errMsg)
-				}
-
-				// mask panic response
-				rErr.Message = "masked panic"
-				continue
+		// handle panic error
+		if strings.HasPrefix(rErr.Message, panicMsg) {
+			// only log panic msg if it is not empty
+			if rErr.Message != panicMsg {
+				errorMsg = append(errorMsg, rErr.Message)
 			}
 
-			errorMsg = append(errorMsg, rErr.Message)
+			// mask panic response
+			rErr.Message = "masked panic"
+			continue
 		}
+
+		errorMsg = append(errorMsg, rErr.Message)
 	}
 
 	if len(errorMsg) > 0 {
 		log.Error().Err(errors.New(strings.Join(errorMsg, ", "))).Send()
 	}
 
-	responseJSON, err := json.Marshal(response)
-	if err != nil {
-		log.Panic().Err(err).Send()
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	if is500 {
-		http.Error(w, string(responseJSON), http.StatusInternalServerError)
-	} else {
-		w.Write(responseJSON)
-	}
+	return is500
 }
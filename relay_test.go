@@ -0,0 +1,197 @@
+package brick
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	be "github.com/pickjunk/brick/error"
+	assert "github.com/stretchr/testify/assert"
+)
+
+type relayResolver struct{}
+
+func (r *relayResolver) Greeting(args struct{ Name *string }) string {
+	if args.Name == nil {
+		return "hello world"
+	}
+	return "hello " + *args.Name
+}
+
+func (r *relayResolver) Boom() string {
+	panic("boom")
+}
+
+func (r *relayResolver) Business() string {
+	be.Throw(10001, "business")
+	return ""
+}
+
+func (r *relayResolver) Returned() (string, error) {
+	return "", &be.BusinessError{Code: 10002, Msg: "returned \"quoted\""}
+}
+
+func (r *relayResolver) Touch() bool {
+	return true
+}
+
+func (r *relayResolver) Tick(ctx context.Context, args struct{ N int32 }) <-chan int32 {
+	c := make(chan int32)
+	go func() {
+		defer close(c)
+		for i := int32(1); args.N == 0 || i <= args.N; i++ {
+			select {
+			case <-ctx.Done():
+				return
+			case c <- i:
+			}
+		}
+	}()
+	return c
+}
+
+func newRelayRouter() *Router {
+	g := NewGraphql(&relayResolver{})
+	g.Schema(`
+	type Query {
+		greeting(name: String): String!
+	}
+	type Mutation {
+		touch: Boolean!
+	}
+	type Subscription {
+		tick(n: Int!): Int!
+	}
+	`)
+
+	r := New()
+	r.Graphql("/graphql", g)
+	return r
+}
+
+func TestRelay(t *testing.T) {
+	r := newRelayRouter()
+
+	cases := []struct {
+		name                   string
+		method, path           string
+		contentType, accept    string
+		body                   string
+		status                 int
+		responseType, response string
+	}{
+		{
+			"get", "GET", "/graphql?" + url.Values{
+				"query":     {"query($name: String) { greeting(name: $name) }"},
+				"variables": {`{"name":"bob"}`},
+			}.Encode(), "", "", "",
+			200, "application/json; charset=utf-8", `{"data":{"greeting":"hello bob"}}`,
+		},
+		{
+			"get mutation", "GET", "/graphql?query=" + url.QueryEscape("mutation { touch }"), "", "", "",
+			405, "application/json; charset=utf-8", `{"errors":[{"message":"only queries are allowed by GET"}]}`,
+		},
+		{
+			"get without query", "GET", "/graphql", "", "", "",
+			400, "application/json; charset=utf-8", `{"errors":[{"message":"query is required"}]}`,
+		},
+		{
+			"get bad variables", "GET", "/graphql?query=%7Bgreeting%7D&variables=x", "", "", "",
+			400, "application/json; charset=utf-8", `{"errors":[{"message":"variables must be a JSON object"}]}`,
+		},
+		{
+			"post json", "POST", "/graphql", "application/json", "", `{"query":"mutation { touch }"}`,
+			200, "application/json; charset=utf-8", `{"data":{"touch":true}}`,
+		},
+		{
+			"post graphql", "POST", "/graphql?operationName=a", "application/graphql", "", `query a { greeting } query b { greeting(name: "b") }`,
+			200, "application/json; charset=utf-8", `{"data":{"greeting":"hello world"}}`,
+		},
+		{
+			"post unsupported", "POST", "/graphql", "text/plain", "", `{ greeting }`,
+			415, "application/json; charset=utf-8", `{"errors":[{"message":"unsupported Content-Type text/plain"}]}`,
+		},
+		{
+			"post bad json", "POST", "/graphql", "application/json", "", `{`,
+			400, "application/json; charset=utf-8", `{"errors":[{"message":"invalid JSON body: unexpected end of JSON input"}]}`,
+		},
+		{
+			"graphql-response+json", "POST", "/graphql", "application/json", "application/graphql-response+json", `{"query":"{ greeting }"}`,
+			200, "application/graphql-response+json; charset=utf-8", `{"data":{"greeting":"hello world"}}`,
+		},
+		{
+			"graphql-response+json validation error", "POST", "/graphql", "application/json", "application/graphql-response+json", `{"query":"{ unknown }"}`,
+			400, "application/graphql-response+json; charset=utf-8", `"errors":`,
+		},
+		{
+			"json validation error", "POST", "/graphql", "application/json", "application/json", `{"query":"{ unknown }"}`,
+			200, "application/json; charset=utf-8", `"errors":`,
+		},
+		{
+			"not acceptable", "POST", "/graphql", "application/json", "text/html", `{"query":"{ greeting }"}`,
+			406, "text/plain; charset=utf-8", "Not Acceptable",
+		},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		if c.contentType != "" {
+			req.Header.Set("Content-Type", c.contentType)
+		}
+		if c.accept != "" {
+			req.Header.Set("Accept", c.accept)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, c.status, w.Code, c.name)
+		assert.Equal(t, c.responseType, w.Header().Get("Content-Type"), c.name)
+		assert.Contains(t, w.Body.String(), c.response, c.name)
+	}
+}
+
+func TestRelayAllow(t *testing.T) {
+	r := newRelayRouter()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/graphql?query="+url.QueryEscape("mutation { touch }"), nil))
+	assert.Equal(t, "POST", w.Header().Get("Allow"))
+}
+
+func TestRelayBusinessError(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGraphql(&relayResolver{})
+	g.Schema(`
+	type Query {
+		business: String!
+		returned: String!
+	}
+	`)
+	r := New()
+	r.Graphql("/graphql", g)
+
+	query := func(q string) string {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/graphql?query="+url.QueryEscape(q), nil))
+		assert.Equal(200, w.Code)
+		return w.Body.String()
+	}
+
+	assert.Equal(
+		`{"errors":[{"message":"business","path":["business"],"extensions":{"code":10001}}],"data":null}`,
+		query("{ business }"),
+	)
+	assert.Equal(
+		`{"errors":[{"message":"returned \"quoted\"","path":["returned"],"extensions":{"code":10002}}],"data":null}`,
+		query("{ returned }"),
+	)
+
+	g.LegacyErrors(true)
+	assert.Equal(
+		`{"errors":[{"message":"{\"code\":10001,\"msg\":\"business\"}","path":["business"],"extensions":{"code":10001}}],"data":null}`,
+		query("{ business }"),
+	)
+}
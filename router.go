@@ -2,9 +2,7 @@ package brick
 
 import (
 	"context"
-	"net"
 	"net/http"
-	"os"
 
 	httprouter "github.com/julienschmidt/httprouter"
 	cors "github.com/rs/cors"
@@ -15,40 +13,26 @@ type Router struct {
 	prefix      string
 	middlewares []Middleware
 	cors        *cors.Cors
+	lifecycle   *lifecycle
+	routes      *routes
 	*httprouter.Router
 }
 
+// builtin middlewares, run before any other middlewares of every route
+var builtinMiddlewares = []Middleware{
+	logMiddleware,
+	recoverMiddleware,
+}
+
 // New create a brick Router
 func New() *Router {
 	return &Router{
-		Router: httprouter.New(),
-		middlewares: []Middleware{
-			logMiddleware,
-			recoverMiddleware,
-		},
-	}
-}
-
-// ListenAndServe is a shortcut for http.ListenAndServe
-func (r *Router) ListenAndServe() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-
-	log.Info().Str("port", port).Msg("http.ListenAndServe")
-
-	err := http.ListenAndServe(":"+port, r)
-	if err != nil {
-		log.Panic().Err(err).Send()
+		Router:    httprouter.New(),
+		lifecycle: newLifecycle(),
+		routes:    newRoutes(),
 	}
 }
 
-// Serve is a shortcut for http.Serve
-func (r *Router) Serve(l net.Listener) {
-	log.Panic().Err(http.Serve(l, r)).Send()
-}
-
 // Prefix append prefix
 func (r *Router) Prefix(p string) *Router {
 	new := *r
@@ -59,7 +43,10 @@ func (r *Router) Prefix(p string) *Router {
 // Middlewares register middlewares
 func (r *Router) Middlewares(layers ...Middleware) *Router {
 	new := *r
-	new.middlewares = append(r.middlewares, layers...)
+	// always copy, or siblings may share the same backing array
+	new.middlewares = make([]Middleware, 0, len(r.middlewares)+len(layers))
+	new.middlewares = append(new.middlewares, r.middlewares...)
+	new.middlewares = append(new.middlewares, layers...)
 	return &new
 }
 
@@ -78,32 +65,63 @@ type Middleware = func(context.Context, Handle)
 
 // Handle define a route
 func (r *Router) Handle(method, path string, middlewaresAndHandle ...interface{}) *Router {
+	return r.handle(method, path, "", caller(), middlewaresAndHandle)
+}
+
+// handle define a route, with the handler name and source recorded,
+// handler name is resolved from the handle if it is empty
+func (r *Router) handle(method, path, handler, source string, middlewaresAndHandle []interface{}) *Router {
 	l := len(middlewaresAndHandle)
 	if l == 0 {
 		log.Panic().Msg("expect brick.Handle")
 	}
 
 	var handle Handle
+	var typed *TypedHandle
 	switch h := middlewaresAndHandle[l-1].(type) {
 	case Handle:
 		handle = h
+	case *TypedHandle:
+		handle = h.Handle
+		typed = h
 	case http.Handler:
 		handle = func(ctx context.Context) {
 			h.ServeHTTP(Response(ctx), Request(ctx))
 		}
 	default:
-		log.Panic().Msgf("expect brick.Handle or http.Handler, but get %T", middlewaresAndHandle[l-1])
+		log.Panic().Msgf("expect brick.Handle, *brick.TypedHandle or http.Handler, but get %T", middlewaresAndHandle[l-1])
+	}
+	if handler == "" {
+		handler = handlerName(middlewaresAndHandle[l-1])
 	}
 
-	middlewares := r.middlewares
+	// middlewares of this route, except the builtin ones
+	scoped := make([]Middleware, 0, len(r.middlewares)+l-1)
+	scoped = append(scoped, r.middlewares...)
 	for i := 0; i < l-1; i++ {
 		middleware, ok := middlewaresAndHandle[i].(Middleware)
 		if !ok {
 			log.Panic().Msgf("expect brick.Middleware, but get %T", middlewaresAndHandle[i])
 		}
-		middlewares = append(middlewares, middleware)
+		scoped = append(scoped, middleware)
+	}
+
+	route := r.prefix + path
+	reg := &registration{
+		method:      method,
+		path:        route,
+		middlewares: scoped,
+		handle:      handle,
+		typed:       typed,
+		handler:     handler,
+		cors:        r.cors,
+		source:      source,
 	}
 
+	middlewares := make([]Middleware, 0, len(builtinMiddlewares)+len(scoped))
+	middlewares = append(middlewares, builtinMiddlewares...)
+	middlewares = append(middlewares, scoped...)
+
 	// handle wrapped with middlewares
 	for i := len(middlewares) - 1; i >= 0; i-- {
 		middleware := middlewares[i]
@@ -114,9 +132,10 @@ func (r *Router) Handle(method, path string, middlewaresAndHandle ...interface{}
 	}
 
 	// wrap it as httprouter.Handle
-	// attach response, request, params to context
+	// attach response, request, params, route pattern to context
 	hrHandle := func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		ctx := withValue(r.Context(), "http", &HTTP{w, r, ps})
+		ctx = withValue(ctx, "route", route)
 		handle(ctx)
 	}
 
@@ -124,8 +143,8 @@ func (r *Router) Handle(method, path string, middlewaresAndHandle ...interface{}
 
 	// compatible with rs/cors
 	if r.cors != nil {
-		if method != "OPTIONS" {
-			hr.Handle("OPTIONS", r.prefix+path, func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		if method != "OPTIONS" && r.routes.preflight(route) {
+			hr.Handle("OPTIONS", route, func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 				r.cors.HandlerFunc(w, req)
 			})
 		}
@@ -137,7 +156,8 @@ func (r *Router) Handle(method, path string, middlewaresAndHandle ...interface{}
 		}
 	}
 
-	hr.Handle(method, r.prefix+path, hrHandle)
+	hr.Handle(method, route, hrHandle)
+	r.routes.add(reg)
 
 	return r
 }
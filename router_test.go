@@ -3,6 +3,7 @@ package brick
 import (
 	"context"
 	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
 	"testing"
 
@@ -224,3 +225,132 @@ func TestCORS(t *testing.T) {
 
 	assert.Equal(t, 2, foo)
 }
+
+func TestMiddlewaresIsolation(t *testing.T) {
+	r := New()
+	var seq []string
+
+	mark := func(name string) Middleware {
+		return func(ctx context.Context, next Handle) {
+			seq = append(seq, name)
+			next(ctx)
+		}
+	}
+
+	a := r.Middlewares(mark("a"))
+	// a.middlewares may have extra capacity, siblings must not share it
+	b := a.Middlewares(mark("b"))
+	c := a.Middlewares(mark("c"))
+
+	b.GET("/b", func(ctx context.Context) {})
+	c.GET("/c", func(ctx context.Context) {})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/b", nil))
+	assert.Equal(t, []string{"a", "b"}, seq)
+
+	seq = nil
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/c", nil))
+	assert.Equal(t, []string{"a", "c"}, seq)
+}
+
+func TestGroup(t *testing.T) {
+	r := New()
+	var seq []string
+
+	r.Group("/api", func(g *Router) {
+		g = g.Middlewares(func(ctx context.Context, next Handle) {
+			seq = append(seq, "api")
+			next(ctx)
+		})
+
+		g.Group("/v1", func(g *Router) {
+			g.Middlewares(func(ctx context.Context, next Handle) {
+				seq = append(seq, "v1")
+				next(ctx)
+			}).GET("/a", func(ctx context.Context) {
+				seq = append(seq, "a")
+			})
+		})
+
+		g.GET("/b", func(ctx context.Context) {
+			seq = append(seq, "b")
+		})
+	}).GET("/c", func(ctx context.Context) {
+		seq = append(seq, "c")
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/a", nil))
+	assert.Equal(t, []string{"api", "v1", "a"}, seq)
+
+	seq = nil
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/b", nil))
+	assert.Equal(t, []string{"api", "b"}, seq)
+
+	seq = nil
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/c", nil))
+	assert.Equal(t, []string{"c"}, seq)
+}
+
+func TestMount(t *testing.T) {
+	var seq []string
+
+	sub := New()
+	sub.Middlewares(func(ctx context.Context, next Handle) {
+		seq = append(seq, "sub")
+		next(ctx)
+	}).CORS(cors.AllowAll()).GET("/user/:id", func(ctx context.Context) {
+		seq = append(seq, "user "+Param(ctx, "id")+" "+Route(ctx))
+	}).POST("/user/:id", func(ctx context.Context) {
+		seq = append(seq, "post")
+	})
+	sub.OnShutdown(func(ctx context.Context) error {
+		seq = append(seq, "shutdown")
+		return nil
+	})
+
+	r := New()
+	r.Middlewares(func(ctx context.Context, next Handle) {
+		seq = append(seq, "app")
+		next(ctx)
+	}).Mount("/team", sub)
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/team/user/1", nil))
+	assert.Equal(t, []string{"app", "sub", "user 1 /team/user/:id"}, seq)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("OPTIONS", "/team/user/1", nil)
+	req.Header.Add("Origin", "foo")
+	req.Header.Add("Access-Control-Request-Method", "POST")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+
+	seq = nil
+	r.Prefix("/static").Mount("/files", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		seq = append(seq, req.Method+" "+req.URL.Path)
+	}))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/static/files/a/b.txt", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/static/files/c", nil))
+	assert.Equal(t, []string{"GET /a/b.txt", "DELETE /c"}, seq)
+
+	// a router with a mounted handler is mounted again
+	seq = nil
+	inner := New()
+	inner.Mount("/static", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		seq = append(seq, req.URL.Path+" "+req.URL.EscapedPath())
+	}))
+	app := New()
+	app.Mount("/team", inner)
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/team/static/a.css", nil))
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/team/static/a%2Fb.css", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, []string{"/a.css /a.css", "/a/b.css /a%2Fb.css"}, seq)
+
+	seq = nil
+	r.Shutdown(context.Background())
+	assert.Equal(t, []string{"shutdown"}, seq)
+
+	assert.Panics(t, func() {
+		r.Mount("/x", "not a handler")
+	})
+}
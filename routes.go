@@ -0,0 +1,162 @@
+package brick
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+
+	httprouter "github.com/julienschmidt/httprouter"
+	cors "github.com/rs/cors"
+)
+
+// registration of a route, recorded by Router.Handle
+type registration struct {
+	method string
+	path   string
+	// middlewares of the route, except the builtin ones
+	middlewares []Middleware
+	handle      Handle
+	// nil unless created by JSON
+	typed *TypedHandle
+	// name of the handle, or type of the http.Handler
+	handler string
+	cors    *cors.Cors
+	// file:line where the route is registered
+	source string
+}
+
+// routes is shared by a Router and all its copies
+type routes struct {
+	sync.Mutex
+	list []*registration
+	// paths whose OPTIONS handle is registered for CORS preflight
+	preflights map[string]bool
+	// info of the OpenAPI document, set by Router.OpenAPI
+	openapi *OpenAPIInfo
+	// graphql endpoints by path, registered by Router.Graphql
+	graphqls map[string]*graphqlEndpoint
+}
+
+func newRoutes() *routes {
+	return &routes{
+		preflights: make(map[string]bool),
+		graphqls:   make(map[string]*graphqlEndpoint),
+	}
+}
+
+func (rs *routes) add(reg *registration) {
+	rs.Lock()
+	defer rs.Unlock()
+
+	rs.list = append(rs.list, reg)
+}
+
+func (rs *routes) all() []*registration {
+	rs.Lock()
+	defer rs.Unlock()
+
+	list := make([]*registration, len(rs.list))
+	copy(list, rs.list)
+	return list
+}
+
+// preflight return true if the OPTIONS handle of path
+// for CORS preflight has not been registered yet
+func (rs *routes) preflight(path string) bool {
+	rs.Lock()
+	defer rs.Unlock()
+
+	if rs.preflights[path] {
+		return false
+	}
+	rs.preflights[path] = true
+	return true
+}
+
+// RouteInfo describe a registered route
+type RouteInfo struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Handler string `json:"handler"`
+	// Middlewares in the order they run, builtin ones included
+	Middlewares []string `json:"middlewares"`
+	CORS        bool     `json:"cors"`
+	// Source file:line where the route is registered
+	Source string `json:"source"`
+}
+
+// Routes list all routes registered on the Router
+// (and its copies), in the order of registration
+func (r *Router) Routes() []RouteInfo {
+	var infos []RouteInfo
+	for _, reg := range r.routes.all() {
+		var middlewares []string
+		for _, m := range builtinMiddlewares {
+			middlewares = append(middlewares, funcName(m))
+		}
+		for _, m := range reg.middlewares {
+			middlewares = append(middlewares, funcName(m))
+		}
+
+		infos = append(infos, RouteInfo{
+			Method:      reg.method,
+			Path:        reg.path,
+			Handler:     reg.handler,
+			Middlewares: middlewares,
+			CORS:        reg.cors != nil,
+			Source:      reg.source,
+		})
+	}
+	return infos
+}
+
+// DebugRoutes serve the routes list as JSON on path, without middlewares
+func (r *Router) DebugRoutes(path string) *Router {
+	r.Router.Handle("GET", r.prefix+path, func(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.Routes())
+	})
+	return r
+}
+
+func funcName(f interface{}) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+	return fn.Name()
+}
+
+func handlerName(h interface{}) string {
+	switch f := h.(type) {
+	case Handle:
+		return funcName(f)
+	case *TypedHandle:
+		return f.name
+	case http.HandlerFunc:
+		return funcName(f)
+	default:
+		return fmt.Sprintf("%T", h)
+	}
+}
+
+// caller find the first frame outside the methods of Router,
+// which is where the route is registered
+func caller() string {
+	pc := make([]uintptr, 16)
+	n := runtime.Callers(2, pc)
+	frames := runtime.CallersFrames(pc[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "github.com/pickjunk/brick.(*Router).") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package brick
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cors "github.com/rs/cors"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func testAuth(ctx context.Context, next Handle) {
+	next(ctx)
+}
+
+func testHello(ctx context.Context) {}
+
+func TestRoutes(t *testing.T) {
+	r := New()
+	r.Middlewares(testAuth).GET("/hello/:name", testHello)
+	r.CORS(cors.AllowAll()).Mount("/static", http.NotFoundHandler())
+	r.DebugRoutes("/debug/routes")
+
+	routes := r.Routes()
+	assert.Equal(t, 7, len(routes))
+
+	hello := routes[0]
+	assert.Equal(t, "GET", hello.Method)
+	assert.Equal(t, "/hello/:name", hello.Path)
+	assert.Equal(t, "github.com/pickjunk/brick.testHello", hello.Handler)
+	assert.Equal(t, []string{
+		"github.com/pickjunk/brick.logMiddleware",
+		"github.com/pickjunk/brick.recoverMiddleware",
+		"github.com/pickjunk/brick.testAuth",
+	}, hello.Middlewares)
+	assert.False(t, hello.CORS)
+	assert.Regexp(t, `routes_test.go:\d+$`, hello.Source)
+
+	static := routes[1]
+	assert.Equal(t, "/static/*brick_mount", static.Path)
+	assert.Equal(t, "net/http.NotFound", static.Handler)
+	assert.True(t, static.CORS)
+	assert.Regexp(t, `routes_test.go:\d+$`, static.Source)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/debug/routes", nil))
+	var served []RouteInfo
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &served))
+	assert.Equal(t, routes, served)
+
+	// mounted routes keep their handler and source
+	app := New()
+	app.Mount("/team", r)
+	assert.Equal(t, "/team/hello/:name", app.Routes()[0].Path)
+	assert.Equal(t, hello.Handler, app.Routes()[0].Handler)
+	assert.Equal(t, hello.Source, app.Routes()[0].Source)
+}
+
+func TestRoutesCommand(t *testing.T) {
+	r := New()
+	r.GET("/hello/:name", testHello)
+
+	var out bytes.Buffer
+	assert.Nil(t, r.run([]string{"routes"}, &out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.True(t, strings.HasPrefix(lines[0], "METHOD"))
+	assert.Contains(t, lines[1], "/hello/:name")
+	assert.Contains(t, lines[1], "brick.testHello")
+
+	out.Reset()
+	assert.Nil(t, r.run([]string{"routes", "-json"}, &out))
+	var routes []RouteInfo
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &routes))
+	assert.Equal(t, r.Routes(), routes)
+
+	assert.Error(t, r.run([]string{"unknown"}, &out))
+}
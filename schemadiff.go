@@ -0,0 +1,347 @@
+package brick
+
+import (
+	"fmt"
+	"sort"
+
+	gqlparser "github.com/vektah/gqlparser/v2"
+	ast "github.com/vektah/gqlparser/v2/ast"
+)
+
+// levels of schema changes
+const (
+	// SchemaChangeBreaking breaks existing clients, e.g. a removed field
+	SchemaChangeBreaking = "breaking"
+	// SchemaChangeDangerous may break existing clients at runtime,
+	// e.g. a new enum value, which is unknown to a switch of clients
+	SchemaChangeDangerous = "dangerous"
+	// SchemaChangeSafe is compatible with existing clients
+	SchemaChangeSafe = "safe"
+)
+
+// SchemaChange between two versions of a schema
+type SchemaChange struct {
+	Level string `json:"level"`
+	// Path of the changed element, e.g. Query.user(id:)
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// DiffSchema compare two versions of SDL, changes are sorted
+// by level (breaking first), then by path
+func DiffSchema(oldSDL, newSDL string) ([]*SchemaChange, error) {
+	oldSchema, err := gqlparser.LoadSchema(&ast.Source{Name: "old", Input: oldSDL})
+	if err != nil {
+		return nil, fmt.Errorf("old schema: %s", err)
+	}
+	newSchema, err := gqlparser.LoadSchema(&ast.Source{Name: "new", Input: newSDL})
+	if err != nil {
+		return nil, fmt.Errorf("new schema: %s", err)
+	}
+
+	d := &schemaDiff{}
+	d.roots(oldSchema, newSchema)
+	d.types(oldSchema, newSchema)
+	d.directives(oldSchema, newSchema)
+
+	levels := map[string]int{SchemaChangeBreaking: 0, SchemaChangeDangerous: 1, SchemaChangeSafe: 2}
+	sort.SliceStable(d.changes, func(i, j int) bool {
+		a, b := d.changes[i], d.changes[j]
+		if a.Level != b.Level {
+			return levels[a.Level] < levels[b.Level]
+		}
+		return a.Path < b.Path
+	})
+	return d.changes, nil
+}
+
+type schemaDiff struct {
+	changes []*SchemaChange
+}
+
+func (d *schemaDiff) add(level, path, format string, args ...interface{}) {
+	d.changes = append(d.changes, &SchemaChange{
+		Level:   level,
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (d *schemaDiff) roots(o, n *ast.Schema) {
+	name := func(def *ast.Definition) string {
+		if def == nil {
+			return ""
+		}
+		return def.Name
+	}
+	for _, root := range []struct {
+		op       string
+		old, new *ast.Definition
+	}{
+		{"query", o.Query, n.Query},
+		{"mutation", o.Mutation, n.Mutation},
+		{"subscription", o.Subscription, n.Subscription},
+	} {
+		a, b := name(root.old), name(root.new)
+		switch {
+		case a == b:
+		case a == "":
+			d.add(SchemaChangeSafe, "schema."+root.op, "root type %s added", b)
+		case b == "":
+			d.add(SchemaChangeBreaking, "schema."+root.op, "root type %s removed", a)
+		default:
+			d.add(SchemaChangeBreaking, "schema."+root.op, "root type changed from %s to %s", a, b)
+		}
+	}
+}
+
+func (d *schemaDiff) types(o, n *ast.Schema) {
+	for _, name := range sortedTypes(o) {
+		a := o.Types[name]
+		b := n.Types[name]
+		if b == nil {
+			d.add(SchemaChangeBreaking, name, "type removed")
+			continue
+		}
+		if a.Kind != b.Kind {
+			d.add(SchemaChangeBreaking, name, "kind changed from %s to %s", a.Kind, b.Kind)
+			continue
+		}
+
+		switch a.Kind {
+		case ast.Object, ast.Interface:
+			d.fields(name, a, b)
+			d.members(name, "interface", a.Interfaces, b.Interfaces, SchemaChangeDangerous)
+		case ast.InputObject:
+			d.inputFields(name, a, b)
+		case ast.Enum:
+			var av, bv []string
+			for _, v := range a.EnumValues {
+				av = append(av, v.Name)
+			}
+			for _, v := range b.EnumValues {
+				bv = append(bv, v.Name)
+			}
+			d.members(name, "enum value", av, bv, SchemaChangeDangerous)
+		case ast.Union:
+			d.members(name, "union member", a.Types, b.Types, SchemaChangeDangerous)
+		}
+	}
+
+	for _, name := range sortedTypes(n) {
+		if o.Types[name] == nil {
+			d.add(SchemaChangeSafe, name, "type added")
+		}
+	}
+}
+
+// members compare interfaces, enum values or union members, removed
+// ones are breaking, added ones are of level added
+func (d *schemaDiff) members(path, what string, a, b []string, added string) {
+	in := func(list []string, s string) bool {
+		for _, v := range list {
+			if v == s {
+				return true
+			}
+		}
+		return false
+	}
+	for _, v := range a {
+		if !in(b, v) {
+			d.add(SchemaChangeBreaking, path+"."+v, "%s removed", what)
+		}
+	}
+	for _, v := range b {
+		if !in(a, v) {
+			d.add(added, path+"."+v, "%s added", what)
+		}
+	}
+}
+
+func (d *schemaDiff) fields(typ string, a, b *ast.Definition) {
+	for _, fa := range a.Fields {
+		if isIntrospectionField(fa.Name) {
+			continue
+		}
+		path := typ + "." + fa.Name
+		fb := b.Fields.ForName(fa.Name)
+		if fb == nil {
+			d.add(SchemaChangeBreaking, path, "field removed")
+			continue
+		}
+
+		if !safeOutputChange(fa.Type, fb.Type) {
+			d.add(SchemaChangeBreaking, path, "type changed from %s to %s", fa.Type, fb.Type)
+		} else if fa.Type.String() != fb.Type.String() {
+			d.add(SchemaChangeSafe, path, "type changed from %s to %s", fa.Type, fb.Type)
+		}
+
+		if deprecated(fa.Directives) == nil && deprecated(fb.Directives) != nil {
+			d.add(SchemaChangeSafe, path, "field deprecated")
+		}
+
+		d.arguments(path, fa.Arguments, fb.Arguments)
+	}
+
+	for _, fb := range b.Fields {
+		if !isIntrospectionField(fb.Name) && a.Fields.ForName(fb.Name) == nil {
+			d.add(SchemaChangeSafe, typ+"."+fb.Name, "field added")
+		}
+	}
+}
+
+func (d *schemaDiff) arguments(path string, a, b ast.ArgumentDefinitionList) {
+	for _, arg := range a {
+		p := path + "(" + arg.Name + ":)"
+		argB := b.ForName(arg.Name)
+		if argB == nil {
+			d.add(SchemaChangeBreaking, p, "argument removed")
+			continue
+		}
+		d.input(p, "argument", arg.Type, argB.Type, arg.DefaultValue, argB.DefaultValue)
+	}
+	for _, arg := range b {
+		if a.ForName(arg.Name) != nil {
+			continue
+		}
+		p := path + "(" + arg.Name + ":)"
+		if arg.Type.NonNull && arg.DefaultValue == nil {
+			d.add(SchemaChangeBreaking, p, "required argument added")
+		} else {
+			d.add(SchemaChangeDangerous, p, "optional argument added")
+		}
+	}
+}
+
+func (d *schemaDiff) inputFields(typ string, a, b *ast.Definition) {
+	for _, fa := range a.Fields {
+		path := typ + "." + fa.Name
+		fb := b.Fields.ForName(fa.Name)
+		if fb == nil {
+			d.add(SchemaChangeBreaking, path, "input field removed")
+			continue
+		}
+		d.input(path, "input field", fa.Type, fb.Type, fa.DefaultValue, fb.DefaultValue)
+	}
+	for _, fb := range b.Fields {
+		if a.Fields.ForName(fb.Name) != nil {
+			continue
+		}
+		path := typ + "." + fb.Name
+		if fb.Type.NonNull && fb.DefaultValue == nil {
+			d.add(SchemaChangeBreaking, path, "required input field added")
+		} else {
+			d.add(SchemaChangeDangerous, path, "optional input field added")
+		}
+	}
+}
+
+// input compare the type and the default value of an argument or an input field
+func (d *schemaDiff) input(path, what string, a, b *ast.Type, da, db *ast.Value) {
+	if !safeInputChange(a, b) {
+		d.add(SchemaChangeBreaking, path, "%s type changed from %s to %s", what, a, b)
+	} else if a.String() != b.String() {
+		d.add(SchemaChangeSafe, path, "%s type changed from %s to %s", what, a, b)
+	}
+
+	va, vb := "", ""
+	if da != nil {
+		va = da.String()
+	}
+	if db != nil {
+		vb = db.String()
+	}
+	if va != vb {
+		d.add(SchemaChangeDangerous, path, "default value changed from %q to %q", va, vb)
+	}
+}
+
+func (d *schemaDiff) directives(o, n *ast.Schema) {
+	names := make([]string, 0, len(o.Directives))
+	for name, dir := range o.Directives {
+		if !builtinDirective(dir) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		a := o.Directives[name]
+		b := n.Directives[name]
+		path := "@" + name
+		if b == nil {
+			d.add(SchemaChangeBreaking, path, "directive removed")
+			continue
+		}
+		var la, lb []string
+		for _, l := range a.Locations {
+			la = append(la, string(l))
+		}
+		for _, l := range b.Locations {
+			lb = append(lb, string(l))
+		}
+		d.members(path, "location", la, lb, SchemaChangeSafe)
+		d.arguments(path, a.Arguments, b.Arguments)
+	}
+
+	added := []string{}
+	for name, dir := range n.Directives {
+		if !builtinDirective(dir) && o.Directives[name] == nil {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+	for _, name := range added {
+		d.add(SchemaChangeSafe, "@"+name, "directive added")
+	}
+}
+
+// sortedTypes names of types of s, builtin ones excluded
+func sortedTypes(s *ast.Schema) []string {
+	names := make([]string, 0, len(s.Types))
+	for name, def := range s.Types {
+		if !def.BuiltIn {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// builtinDirective return true for directives of the specification,
+// e.g. @skip and @deprecated
+func builtinDirective(dir *ast.DirectiveDefinition) bool {
+	return dir.Position != nil && dir.Position.Src != nil && dir.Position.Src.BuiltIn
+}
+
+func isIntrospectionField(name string) bool {
+	return len(name) > 1 && name[:2] == "__"
+}
+
+func deprecated(list ast.DirectiveList) *ast.Directive {
+	return list.ForName("deprecated")
+}
+
+// safeOutputChange return true if clients reading a field of type a can
+// read type b, which may only be non-null where a is nullable
+func safeOutputChange(a, b *ast.Type) bool {
+	if a.NonNull && !b.NonNull {
+		return false
+	}
+	if a.Elem != nil {
+		return b.Elem != nil && safeOutputChange(a.Elem, b.Elem)
+	}
+	return b.Elem == nil && a.NamedType == b.NamedType
+}
+
+// safeInputChange return true if values of type a sent by clients are
+// valid for type b, which may only be nullable where a is non-null
+func safeInputChange(a, b *ast.Type) bool {
+	if !a.NonNull && b.NonNull {
+		return false
+	}
+	if a.Elem != nil {
+		return b.Elem != nil && safeInputChange(a.Elem, b.Elem)
+	}
+	return b.Elem == nil && a.NamedType == b.NamedType
+}
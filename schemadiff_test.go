@@ -0,0 +1,162 @@
+package brick
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+const oldTestSchema = `
+type Query {
+	user(id: ID!, active: Boolean = true): User
+	users(first: Int): [User!]!
+	node(id: ID!): Node
+	search(q: String!): SearchResult
+}
+
+interface Node {
+	id: ID!
+}
+
+type User implements Node {
+	id: ID!
+	name: String
+	email: String!
+	role: Role!
+	legacy: String
+}
+
+input UserFilter {
+	name: String
+	role: Role!
+}
+
+enum Role {
+	ADMIN
+	MEMBER
+	GUEST
+}
+
+union SearchResult = User
+
+directive @auth(role: Role!) on FIELD_DEFINITION
+`
+
+const newTestSchema = `
+type Query {
+	user(id: ID!, active: Boolean = false, locale: String): User
+	users(first: Int!, after: String): [User!]!
+	node(id: ID!): Node
+	search(q: String!): SearchResult
+	me: User
+}
+
+interface Node {
+	id: ID!
+}
+
+type Team implements Node {
+	id: ID!
+}
+
+type User implements Node {
+	id: ID!
+	name: String!
+	email: String
+	role: Role!
+	legacy: String @deprecated(reason: "gone soon")
+}
+
+input UserFilter {
+	name: String
+	role: Role
+	team: ID!
+}
+
+enum Role {
+	ADMIN
+	MEMBER
+	OWNER
+}
+
+union SearchResult = User | Team
+`
+
+func TestDiffSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	changes, err := DiffSchema(oldTestSchema, newTestSchema)
+	assert.Nil(err)
+
+	var list [][3]string
+	for _, c := range changes {
+		list = append(list, [3]string{c.Level, c.Path, c.Message})
+	}
+	assert.Equal([][3]string{
+		{"breaking", "@auth", "directive removed"},
+		{"breaking", "Query.users(first:)", "argument type changed from Int to Int!"},
+		{"breaking", "Role.GUEST", "enum value removed"},
+		{"breaking", "User.email", "type changed from String! to String"},
+		{"breaking", "UserFilter.team", "required input field added"},
+		{"dangerous", "Query.user(active:)", `default value changed from "true" to "false"`},
+		{"dangerous", "Query.user(locale:)", "optional argument added"},
+		{"dangerous", "Query.users(after:)", "optional argument added"},
+		{"dangerous", "Role.OWNER", "enum value added"},
+		{"dangerous", "SearchResult.Team", "union member added"},
+		{"safe", "Query.me", "field added"},
+		{"safe", "Team", "type added"},
+		{"safe", "User.legacy", "field deprecated"},
+		{"safe", "User.name", "type changed from String to String!"},
+		{"safe", "UserFilter.role", "input field type changed from Role! to Role"},
+	}, list)
+
+	changes, err = DiffSchema(newTestSchema, newTestSchema)
+	assert.Nil(err)
+	assert.Empty(changes)
+
+	_, err = DiffSchema("type Query {", newTestSchema)
+	assert.Regexp("^old schema: ", err.Error())
+}
+
+func TestGraphqlCommand(t *testing.T) {
+	assert := assert.New(t)
+
+	r := newRelayRouter()
+
+	var out bytes.Buffer
+	assert.Nil(r.run([]string{"graphql", "sdl"}, &out))
+	assert.Contains(out.String(), "greeting(name: String): String!")
+
+	out.Reset()
+	assert.Nil(r.run([]string{"graphql", "-path", "/graphql", "introspect"}, &out))
+	assert.Contains(out.String(), `"__schema"`)
+
+	dir := t.TempDir()
+	old := filepath.Join(dir, "old.graphql")
+
+	// compatible with the current schema
+	os.WriteFile(old, []byte("type Query { greeting(name: String): String }"), 0644)
+	out.Reset()
+	assert.Nil(r.run([]string{"graphql", "diff", old}, &out))
+	assert.Contains(out.String(), "SAFE")
+	assert.Contains(out.String(), "0 breaking, 0 dangerous")
+
+	// fields removed
+	os.WriteFile(old, []byte("type Query { greeting(name: String): String! hello: String }"), 0644)
+	out.Reset()
+	assert.EqualError(r.run([]string{"graphql", "diff", old}, &out), "1 breaking changes")
+	assert.Contains(out.String(), "BREAKING  Query.hello")
+
+	// mounted endpoints, which must be chosen by path
+	m := New()
+	m.Mount("/v1", r)
+	m.Mount("/v2", newRelayRouter())
+	assert.EqualError(
+		m.run([]string{"graphql", "sdl"}, &out),
+		"2 graphql endpoints (/v1/graphql, /v2/graphql), choose one by -path",
+	)
+	assert.Nil(m.run([]string{"graphql", "-path", "/v2/graphql", "sdl"}, &out))
+}
@@ -0,0 +1,324 @@
+package brick
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	ast "github.com/vektah/gqlparser/v2/ast"
+	formatter "github.com/vektah/gqlparser/v2/formatter"
+	lexer "github.com/vektah/gqlparser/v2/lexer"
+	parser "github.com/vektah/gqlparser/v2/parser"
+)
+
+// composer merge schema sources into one schema document
+type composer struct {
+	schema     *ast.SchemaDefinition
+	directives map[string]*ast.DirectiveDefinition
+	types      map[string]*ast.Definition
+	doc        *ast.SchemaDocument
+}
+
+// composeSchema merge sources: types (objects, interfaces, inputs, enums,
+// unions) of the same name are merged, type extensions are applied, and
+// identical fields defined more than once are kept once. Conflicts are
+// reported with the sources and lines where they are defined
+func composeSchema(sources []*ast.Source) (*ast.SchemaDocument, error) {
+	c := &composer{
+		schema:     &ast.SchemaDefinition{},
+		directives: make(map[string]*ast.DirectiveDefinition),
+		types:      make(map[string]*ast.Definition),
+		doc:        &ast.SchemaDocument{},
+	}
+
+	var extensions ast.DefinitionList
+	for _, src := range sources {
+		doc, err := parser.ParseSchema(fillEmptyBodies(src))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, s := range append(doc.Schema, doc.SchemaExtension...) {
+			if err := c.mergeSchema(s); err != nil {
+				return nil, err
+			}
+		}
+		for _, d := range doc.Directives {
+			if err := c.mergeDirective(d); err != nil {
+				return nil, err
+			}
+		}
+		for _, def := range doc.Definitions {
+			if err := c.merge(def); err != nil {
+				return nil, err
+			}
+		}
+		extensions = append(extensions, doc.Extensions...)
+	}
+
+	// extensions apply to types defined in any source
+	for _, ext := range extensions {
+		if c.types[ext.Name] == nil {
+			return nil, fmt.Errorf("extend type %s (%s): type %s is not defined", ext.Name, at(ext.Position), ext.Name)
+		}
+		if err := c.merge(ext); err != nil {
+			return nil, err
+		}
+	}
+
+	// empty object types (e.g. type Query {}) are allowed by graphql-go,
+	// they define nothing and are dropped
+	var defs ast.DefinitionList
+	for _, def := range c.doc.Definitions {
+		if def.Kind == ast.Object && len(def.Fields) == 0 {
+			delete(c.types, def.Name)
+			continue
+		}
+		defs = append(defs, def)
+	}
+	c.doc.Definitions = defs
+
+	// root types default to Query, Mutation and Subscription,
+	// roots without a type (e.g. empty ones) are dropped
+	for _, op := range []ast.Operation{ast.Query, ast.Mutation, ast.Subscription} {
+		if c.root(op) == nil {
+			name := strings.ToUpper(string(op[:1])) + string(op[1:])
+			c.schema.OperationTypes = append(c.schema.OperationTypes, &ast.OperationTypeDefinition{
+				Operation: op,
+				Type:      name,
+			})
+		}
+	}
+	var roots ast.OperationTypeDefinitionList
+	for _, o := range c.schema.OperationTypes {
+		if c.types[o.Type] != nil {
+			roots = append(roots, o)
+		}
+	}
+	c.schema.OperationTypes = roots
+	if len(roots) > 0 {
+		c.doc.Schema = ast.SchemaDefinitionList{c.schema}
+	}
+
+	return c.doc, nil
+}
+
+// emptyField is filled in empty bodies of definitions (e.g. {} of
+// type Query {}), which are allowed by graphql-go but not by gqlparser,
+// and is dropped when they are merged
+const emptyField = "__empty"
+
+// fillEmptyBodies fill emptyField in empty bodies of definitions, empty
+// objects of default values are kept
+func fillEmptyBodies(src *ast.Source) *ast.Source {
+	input := []rune(src.Input)
+	var out strings.Builder
+	last := 0
+
+	l := lexer.New(src)
+	var prev lexer.Token
+	// of braces, brackets and parentheses, bodies are of depth 0
+	depth := 0
+	for {
+		tok, err := l.ReadToken()
+		if err != nil || tok.Kind == lexer.EOF {
+			// errors are reported by the parser
+			break
+		}
+		switch tok.Kind {
+		case lexer.Comment:
+			continue
+		case lexer.BraceL, lexer.BracketL, lexer.ParenL:
+			depth++
+		case lexer.BraceR, lexer.BracketR, lexer.ParenR:
+			depth--
+			if tok.Kind == lexer.BraceR && prev.Kind == lexer.BraceL && depth == 0 {
+				// positions are in runes, lines are kept
+				out.WriteString(string(input[last:prev.Pos.End]))
+				out.WriteString(emptyField + ": Int")
+				last = tok.Pos.Start
+			}
+		}
+		prev = tok
+	}
+	if last == 0 {
+		return src
+	}
+	out.WriteString(string(input[last:]))
+	return &ast.Source{Name: src.Name, Input: out.String(), BuiltIn: src.BuiltIn}
+}
+
+// at is the attribution of a position, e.g. user/schema.go:12, line 3
+func at(pos *ast.Position) string {
+	if pos == nil || pos.Src == nil {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s, line %d", pos.Src.Name, pos.Line)
+}
+
+// root type of the operation, nil if it is not defined
+func (c *composer) root(op ast.Operation) *ast.OperationTypeDefinition {
+	for _, o := range c.schema.OperationTypes {
+		if o.Operation == op {
+			return o
+		}
+	}
+	return nil
+}
+
+func (c *composer) mergeSchema(s *ast.SchemaDefinition) error {
+	c.schema.Directives = append(c.schema.Directives, s.Directives...)
+	for _, o := range s.OperationTypes {
+		if exist := c.root(o.Operation); exist != nil {
+			if exist.Type != o.Type {
+				return fmt.Errorf(
+					"schema %s: %s (%s) conflicts with %s (%s)",
+					o.Operation, o.Type, at(o.Position), exist.Type, at(exist.Position),
+				)
+			}
+			continue
+		}
+		c.schema.OperationTypes = append(c.schema.OperationTypes, o)
+	}
+	return nil
+}
+
+func (c *composer) mergeDirective(d *ast.DirectiveDefinition) error {
+	if exist, ok := c.directives[d.Name]; ok {
+		if directiveSignature(exist) != directiveSignature(d) {
+			return fmt.Errorf(
+				"directive @%s (%s) conflicts with the one defined in %s",
+				d.Name, at(d.Position), at(exist.Position),
+			)
+		}
+		return nil
+	}
+	c.directives[d.Name] = d
+	c.doc.Directives = append(c.doc.Directives, d)
+	return nil
+}
+
+// merge a definition, or an extension, into the type of the same name
+func (c *composer) merge(def *ast.Definition) error {
+	t := c.types[def.Name]
+	if t == nil {
+		t = &ast.Definition{
+			Kind:        def.Kind,
+			Description: def.Description,
+			Name:        def.Name,
+			Position:    def.Position,
+		}
+		c.types[def.Name] = t
+		c.doc.Definitions = append(c.doc.Definitions, t)
+	}
+
+	if t.Kind != def.Kind {
+		return fmt.Errorf(
+			"type %s is %s (%s), but %s in %s",
+			def.Name, def.Kind, at(def.Position), t.Kind, at(t.Position),
+		)
+	}
+
+	if t.Description == "" {
+		t.Description = def.Description
+	}
+	for _, d := range def.Directives {
+		if t.Directives.ForName(d.Name) == nil {
+			t.Directives = append(t.Directives, d)
+		}
+	}
+	t.Interfaces = appendUnique(t.Interfaces, def.Interfaces...)
+	t.Types = appendUnique(t.Types, def.Types...)
+
+	for _, f := range def.Fields {
+		if f.Name == emptyField {
+			continue
+		}
+		exist := t.Fields.ForName(f.Name)
+		if exist == nil {
+			t.Fields = append(t.Fields, f)
+			continue
+		}
+		if fieldSignature(exist) != fieldSignature(f) {
+			return fmt.Errorf(
+				"field %s.%s: %s (%s) conflicts with %s (%s)",
+				def.Name, f.Name, fieldSignature(f), at(f.Position), fieldSignature(exist), at(exist.Position),
+			)
+		}
+	}
+
+	for _, v := range def.EnumValues {
+		if t.EnumValues.ForName(v.Name) == nil {
+			t.EnumValues = append(t.EnumValues, v)
+		}
+	}
+
+	return nil
+}
+
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		found := false
+		for _, exist := range list {
+			if exist == item {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// fieldSignature of a field, with its directives, e.g.
+// users(first: Int = 10): [User!]! @cost(value: 2, multiplier: "first")
+func fieldSignature(f *ast.FieldDefinition) string {
+	s := f.Name + argumentsSignature(f.Arguments) + ": " + f.Type.String()
+	if f.DefaultValue != nil {
+		s += " = " + f.DefaultValue.String()
+	}
+	for _, d := range f.Directives {
+		s += " @" + d.Name
+		if len(d.Arguments) == 0 {
+			continue
+		}
+		var list []string
+		for _, a := range d.Arguments {
+			list = append(list, a.Name+": "+a.Value.String())
+		}
+		s += "(" + strings.Join(list, ", ") + ")"
+	}
+	return s
+}
+
+func directiveSignature(d *ast.DirectiveDefinition) string {
+	var locations []string
+	for _, l := range d.Locations {
+		locations = append(locations, string(l))
+	}
+	return "@" + d.Name + argumentsSignature(d.Arguments) + " on " + strings.Join(locations, " | ")
+}
+
+func argumentsSignature(args ast.ArgumentDefinitionList) string {
+	if len(args) == 0 {
+		return ""
+	}
+	var list []string
+	for _, a := range args {
+		s := a.Name + ": " + a.Type.String()
+		if a.DefaultValue != nil {
+			s += " = " + a.DefaultValue.String()
+		}
+		list = append(list, s)
+	}
+	return "(" + strings.Join(list, ", ") + ")"
+}
+
+// printSchema print the schema document as SDL
+func printSchema(doc *ast.SchemaDocument) string {
+	var buf bytes.Buffer
+	formatter.NewFormatter(&buf, formatter.WithIndent("  ")).FormatSchemaDocument(doc)
+	return buf.String()
+}
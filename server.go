@@ -0,0 +1,190 @@
+package brick
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Hook func, run on server start or shutdown
+type Hook = func(context.Context) error
+
+// lifecycle is shared by a Router and all its copies
+// created by Prefix, Middlewares and CORS
+type lifecycle struct {
+	sync.Mutex
+	server     *http.Server
+	onStart    []Hook
+	onShutdown []Hook
+	// run when shutdown starts, to end long-lived connections
+	// (websocket, server-sent events) which are never drained
+	onClose []func()
+
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{
+		done: make(chan struct{}),
+	}
+}
+
+// shutdownTimeout read from env SHUTDOWN_TIMEOUT, default 30s
+func shutdownTimeout() time.Duration {
+	timeout, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT"))
+	if err != nil || timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return timeout
+}
+
+// OnStart register a hook which runs before the server starts
+// accepting connections, hooks run in the order of registration
+func (r *Router) OnStart(h Hook) *Router {
+	r.lifecycle.Lock()
+	defer r.lifecycle.Unlock()
+
+	r.lifecycle.onStart = append(r.lifecycle.onStart, h)
+	return r
+}
+
+// OnShutdown register a hook which runs after the server has stopped
+// accepting connections and drained in-flight requests,
+// hooks run in the order of registration
+func (r *Router) OnShutdown(h Hook) *Router {
+	r.lifecycle.Lock()
+	defer r.lifecycle.Unlock()
+
+	r.lifecycle.onShutdown = append(r.lifecycle.onShutdown, h)
+	return r
+}
+
+// onClose register f which runs when shutdown starts, before
+// in-flight requests are drained
+func (r *Router) onClose(f func()) {
+	r.lifecycle.Lock()
+	defer r.lifecycle.Unlock()
+
+	r.lifecycle.onClose = append(r.lifecycle.onClose, f)
+}
+
+// ListenAndServe listen on env PORT (default 8080) and serve,
+// see Serve for details
+func (r *Router) ListenAndServe() error {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	l, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Str("port", port).Msg("http.ListenAndServe")
+
+	return r.Serve(l)
+}
+
+// Serve run OnStart hooks, then serve on the listener until SIGINT
+// or SIGTERM is received or Shutdown is called, then shutdown gracefully.
+// OnShutdown hooks also run if an OnStart hook or serving fails
+func (r *Router) Serve(l net.Listener) error {
+	lc := r.lifecycle
+
+	srv := &http.Server{Handler: r}
+	lc.Lock()
+	lc.server = srv
+	hooks := lc.onStart
+	lc.Unlock()
+
+	for _, h := range hooks {
+		if err := h(context.Background()); err != nil {
+			l.Close()
+			// let OnShutdown hooks release what earlier hooks acquired
+			r.Shutdown(context.Background())
+			return err
+		}
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(l)
+	}()
+
+	select {
+	case err := <-served:
+		if err != http.ErrServerClosed {
+			r.Shutdown(context.Background())
+			return err
+		}
+		// closed by Shutdown, wait until it finishes
+		<-lc.done
+		return lc.err
+	case s := <-sig:
+		log.Info().Str("signal", s.String()).Msg("http.Shutdown")
+		return r.Shutdown(context.Background())
+	}
+}
+
+// Shutdown stop accepting connections, wait for in-flight requests
+// until env SHUTDOWN_TIMEOUT (default 30s) or ctx expires,
+// then run OnShutdown hooks with another SHUTDOWN_TIMEOUT. It is safe to call Shutdown more than once,
+// only the first call takes effect and all calls return the same error
+func (r *Router) Shutdown(ctx context.Context) error {
+	lc := r.lifecycle
+
+	lc.once.Do(func() {
+		ctx, cancel := context.WithTimeout(ctx, shutdownTimeout())
+		defer cancel()
+
+		lc.Lock()
+		srv := lc.server
+		hooks := lc.onShutdown
+		onClose := lc.onClose
+		lc.Unlock()
+
+		for _, f := range onClose {
+			f()
+		}
+
+		if srv != nil {
+			if err := srv.Shutdown(ctx); err != nil {
+				log.Error().Err(err).Msg("http.Shutdown")
+				lc.err = err
+			}
+		}
+
+		// hooks get a deadline of their own, draining may have used
+		// up all of ctx
+		hookCtx, hookCancel := context.WithTimeout(
+			context.WithoutCancel(ctx), shutdownTimeout())
+		defer hookCancel()
+
+		for _, h := range hooks {
+			if err := h(hookCtx); err != nil {
+				log.Error().Err(err).Msg("shutdown hook")
+				if lc.err == nil {
+					lc.err = err
+				}
+			}
+		}
+
+		log.Info().Msg("http.Shutdown done")
+		close(lc.done)
+	})
+
+	<-lc.done
+	return lc.err
+}
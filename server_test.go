@@ -0,0 +1,122 @@
+package brick
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestShutdown(t *testing.T) {
+	r := New()
+	var seq []string
+
+	started := make(chan struct{})
+	r.GET("/slow", func(ctx context.Context) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		Response(ctx).Write([]byte("done"))
+	})
+
+	r.OnStart(func(ctx context.Context) error {
+		seq = append(seq, "start")
+		return nil
+	}).OnShutdown(func(ctx context.Context) error {
+		seq = append(seq, "shutdown1")
+		return nil
+	}).Prefix("/sub").OnShutdown(func(ctx context.Context) error {
+		seq = append(seq, "shutdown2")
+		return errors.New("hook error")
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- r.Serve(l)
+	}()
+
+	body := make(chan string, 1)
+	go func() {
+		res, err := http.Get("http://" + l.Addr().String() + "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		b := make([]byte, 4)
+		n, _ := res.Body.Read(b)
+		body <- string(b[:n])
+	}()
+
+	<-started
+	err = r.Shutdown(context.Background())
+	assert.EqualError(t, err, "hook error")
+
+	// in-flight request is drained
+	assert.Equal(t, "done", <-body)
+	assert.EqualError(t, <-served, "hook error")
+	assert.Equal(t, []string{"start", "shutdown1", "shutdown2"}, seq)
+
+	// only the first call takes effect
+	assert.EqualError(t, r.Shutdown(context.Background()), "hook error")
+	assert.Equal(t, 3, len(seq))
+}
+
+func TestOnStartError(t *testing.T) {
+	r := New()
+	var seq []string
+	r.OnStart(func(ctx context.Context) error {
+		seq = append(seq, "start1")
+		return nil
+	}).OnStart(func(ctx context.Context) error {
+		return errors.New("start error")
+	}).OnShutdown(func(ctx context.Context) error {
+		seq = append(seq, "shutdown")
+		return nil
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	assert.EqualError(t, r.Serve(l), "start error")
+	// resources of earlier hooks are released
+	assert.Equal(t, []string{"start1", "shutdown"}, seq)
+}
+
+func TestServeError(t *testing.T) {
+	r := New()
+	var seq []string
+	r.OnShutdown(func(ctx context.Context) error {
+		seq = append(seq, "shutdown")
+		return nil
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	l.Close()
+
+	assert.NotNil(t, r.Serve(l))
+	assert.Equal(t, []string{"shutdown"}, seq)
+}
+
+func TestShutdownHookDeadline(t *testing.T) {
+	r := New()
+	var hookErr error
+	r.OnShutdown(func(ctx context.Context) error {
+		hookErr = ctx.Err()
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the caller's ctx is done, hooks still get time to run
+	assert.Nil(t, r.Shutdown(ctx))
+	assert.Nil(t, hookErr)
+}
@@ -0,0 +1,429 @@
+package brick
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	websocket "github.com/gorilla/websocket"
+	graphql "github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	ot "github.com/opentracing/opentracing-go"
+	bm "github.com/pickjunk/brick/metrics"
+)
+
+// SubscriptionConfig config of subscriptions over WebSocket
+type SubscriptionConfig struct {
+	// OnInit is called with the payload of connection_init, the context
+	// returned is used by all operations of the connection, the connection
+	// is closed with 4403 Forbidden if an error is returned
+	OnInit func(ctx context.Context, payload map[string]interface{}) (context.Context, error)
+	// CheckOrigin of the WebSocket handshake, same origin only if nil
+	CheckOrigin func(r *http.Request) bool
+	// InitTimeout to wait for connection_init, 10s if zero
+	InitTimeout time.Duration
+}
+
+// Subscriptions config subscriptions over WebSocket
+func (g *Graphql) Subscriptions(cfg *SubscriptionConfig) *Graphql {
+	c := *cfg
+	g.subscriptions = &c
+	return g
+}
+
+// GraphqlInitPayload get the payload of connection_init
+// of the WebSocket connection from context
+func GraphqlInitPayload(ctx context.Context) map[string]interface{} {
+	payload, _ := value(ctx, "graphql_init").(map[string]interface{})
+	return payload
+}
+
+// interval of keep-alive comments of server-sent events
+const eventStreamKeepAlive = 15 * time.Second
+
+// subscribe execute the operation of params, next is called with every
+// response until the stream ends, return false if ctx is done before that
+func (e *graphqlEndpoint) subscribe(ctx context.Context, params *graphqlParams, next func(*graphql.Response)) bool {
+	span, ctx := ot.StartSpanFromContext(ctx, "graphql.subscription")
+	defer span.Finish()
+	name := params.OperationName
+	if name == "" {
+		name = "anonymous"
+	}
+	span.SetTag("graphql.operation", name)
+	operation := e.operations.label(params)
+
+	result := "ok"
+	defer func() {
+		bm.GraphqlOperations.WithLabelValues(operation, result).Inc()
+	}()
+
+	responses, err := e.schema.Subscribe(ctx, params.Query, params.OperationName, params.Variables)
+	if err != nil {
+		log.Error().Err(err).Msg("graphql subscription")
+		result = "error"
+		next(&graphql.Response{Errors: []*gqlerrors.QueryError{gqlerrors.Errorf("internal error")}})
+		return true
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// drain, or the goroutine of graphql-go sending responses leaks
+			go func() {
+				for range responses {
+				}
+			}()
+			return false
+		case v, ok := <-responses:
+			if !ok {
+				return true
+			}
+			response := v.(*graphql.Response)
+			if len(response.Errors) > 0 {
+				result = "error"
+			}
+			e.maskErrors(response)
+			next(response)
+		}
+	}
+}
+
+// serveEventStream serve the operation as server-sent events, following
+// the distinct connections mode of GraphQL over Server-Sent Events:
+// a next event for every response, then a complete event
+func (e *graphqlEndpoint) serveEventStream(ctx context.Context, params *graphqlParams) {
+	w := Response(ctx)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Panic().Msg("streaming unsupported by the http.ResponseWriter")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	var mu sync.Mutex
+	write := func(s string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		fmt.Fprint(w, s)
+		flusher.Flush()
+	}
+
+	keepAlive := make(chan struct{})
+	defer func() {
+		cancel()
+		<-keepAlive
+	}()
+	go func() {
+		defer close(keepAlive)
+
+		ticker := time.NewTicker(eventStreamKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-e.closing.Done():
+				// server shutdown
+				cancel()
+				return
+			case <-ticker.C:
+				write(":\n\n")
+			}
+		}
+	}()
+
+	failed := false
+	completed := e.subscribe(ctx, params, func(response *graphql.Response) {
+		if failed {
+			return
+		}
+		data, ok := marshalResponse(response)
+		write("event: next\ndata: " + string(data) + "\n\n")
+		if !ok {
+			failed = true
+			cancel()
+		}
+	})
+	if completed || failed || e.closing.Err() != nil {
+		write("event: complete\ndata:\n\n")
+	}
+}
+
+// graphql-transport-ws protocol
+// https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md
+const graphqlTransportWS = "graphql-transport-ws"
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// wsConn is a WebSocket connection of graphql-transport-ws
+type wsConn struct {
+	conn *websocket.Conn
+	// gorilla/websocket supports one concurrent writer
+	writeMu sync.Mutex
+
+	sync.Mutex
+	acked bool
+	// cancel func of operations by id
+	operations map[string]context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+func (c *wsConn) write(msg *wsMessage) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := c.conn.WriteJSON(msg); err != nil {
+		log.Debug().Err(err).Msg("websocket write")
+	}
+}
+
+// close the connection with code and reason, then the read loop ends
+func (c *wsConn) close(code int, reason string) {
+	c.conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, reason),
+		time.Now().Add(time.Second),
+	)
+	c.conn.Close()
+}
+
+func (e *graphqlEndpoint) serveWebSocket(ctx context.Context) {
+	cfg := e.subscriptions
+	upgrader := websocket.Upgrader{
+		Subprotocols: []string{graphqlTransportWS},
+		CheckOrigin:  cfg.CheckOrigin,
+	}
+	conn, err := upgrader.Upgrade(Response(ctx), Request(ctx), nil)
+	if err != nil {
+		// responded by Upgrade
+		return
+	}
+	if n := e.limits.maxRequestBytes(); n > 0 {
+		conn.SetReadLimit(n)
+	}
+
+	c := &wsConn{
+		conn:       conn,
+		operations: make(map[string]context.CancelFunc),
+	}
+	if conn.Subprotocol() != graphqlTransportWS {
+		c.close(4406, "Subprotocol not acceptable")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		c.wg.Wait()
+		conn.Close()
+	}()
+
+	done := ctx.Done()
+	go func() {
+		select {
+		case <-done:
+		case <-e.closing.Done():
+			c.close(websocket.CloseGoingAway, "Server shutdown")
+		}
+	}()
+
+	timeout := cfg.InitTimeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	timer := time.AfterFunc(timeout, func() {
+		c.Lock()
+		acked := c.acked
+		c.Unlock()
+		if !acked {
+			c.close(4408, "Connection initialisation timeout")
+		}
+	})
+	defer timer.Stop()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			// closed by the client, or by close
+			return
+		}
+
+		var msg wsMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.close(4400, "Invalid message")
+			return
+		}
+
+		c.Lock()
+		acked := c.acked
+		c.Unlock()
+
+		switch msg.Type {
+		case "connection_init":
+			if acked {
+				c.close(4429, "Too many initialisation requests")
+				return
+			}
+
+			var payload map[string]interface{}
+			if len(msg.Payload) > 0 {
+				if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+					c.close(4400, "Invalid connection_init payload")
+					return
+				}
+			}
+			ctx = withValue(ctx, "graphql_init", payload)
+			if cfg.OnInit != nil {
+				ctx, err = cfg.OnInit(ctx, payload)
+				if err != nil {
+					c.close(4403, "Forbidden")
+					return
+				}
+			}
+
+			c.Lock()
+			c.acked = true
+			c.Unlock()
+			c.write(&wsMessage{Type: "connection_ack"})
+		case "ping":
+			c.write(&wsMessage{Type: "pong"})
+		case "pong":
+		case "subscribe":
+			if !acked {
+				c.close(4401, "Unauthorized")
+				return
+			}
+
+			params := &graphqlParams{}
+			if msg.ID == "" || json.Unmarshal(msg.Payload, params) != nil {
+				c.close(4400, "Invalid subscribe message")
+				return
+			}
+			if !e.startOperation(ctx, c, msg.ID, params) {
+				c.close(4409, "Subscriber for "+msg.ID+" already exists")
+				return
+			}
+		case "complete":
+			c.Lock()
+			if cancel, ok := c.operations[msg.ID]; ok {
+				cancel()
+			}
+			c.Unlock()
+		default:
+			c.close(4400, "Unknown message type "+msg.Type)
+			return
+		}
+	}
+}
+
+// startOperation run the operation in a goroutine,
+// return false if id is taken by a running operation
+func (e *graphqlEndpoint) startOperation(ctx context.Context, c *wsConn, id string, params *graphqlParams) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	if _, ok := c.operations[id]; ok {
+		return false
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c.operations[id] = cancel
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer func() {
+			c.Lock()
+			delete(c.operations, id)
+			c.Unlock()
+			cancel()
+		}()
+		defer func() {
+			if err := recover(); err != nil {
+				log.Error().Interface("panic", err).Msg("graphql subscription")
+				c.write(&wsMessage{ID: id, Type: "error", Payload: errorsPayload("internal error")})
+			}
+		}()
+
+		if e.persisted != nil {
+			if reqErr := e.persisted.resolve(ctx, params); reqErr != nil {
+				payload, _ := json.Marshal(reqErr.response().Errors)
+				c.write(&wsMessage{ID: id, Type: "error", Payload: payload})
+				return
+			}
+		}
+		if params.Query == "" {
+			c.write(&wsMessage{ID: id, Type: "error", Payload: errorsPayload("query is required")})
+			return
+		}
+		if reqErr := e.limitSize(params, nil); reqErr != nil {
+			payload, _ := json.Marshal(reqErr.response().Errors)
+			c.write(&wsMessage{ID: id, Type: "error", Payload: payload})
+			return
+		}
+		e.parse(ctx, params)
+		if reqErr := e.limit(params, nil); reqErr != nil {
+			payload, _ := json.Marshal(reqErr.response().Errors)
+			c.write(&wsMessage{ID: id, Type: "error", Payload: payload})
+			return
+		}
+
+		failed := false
+		completed := e.subscribe(ctx, params, func(response *graphql.Response) {
+			if failed {
+				return
+			}
+			// errors before execution
+			if response.Data == nil && len(response.Errors) > 0 {
+				failed = true
+				payload, _ := json.Marshal(response.Errors)
+				c.write(&wsMessage{ID: id, Type: "error", Payload: payload})
+				return
+			}
+
+			payload, ok := marshalResponse(response)
+			c.write(&wsMessage{ID: id, Type: "next", Payload: payload})
+			if !ok {
+				failed = true
+				c.write(&wsMessage{ID: id, Type: "complete"})
+				cancel()
+			}
+		})
+		if completed && !failed {
+			c.write(&wsMessage{ID: id, Type: "complete"})
+		}
+	}()
+
+	return true
+}
+
+// marshalResponse marshal response, or an internal error instead if it
+// can not be marshaled, when ok is false and the operation should stop
+func marshalResponse(response *graphql.Response) (data []byte, ok bool) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		log.Error().Err(err).Msg("graphql subscription")
+		data, _ = json.Marshal(map[string]json.RawMessage{"errors": errorsPayload("internal error")})
+		return data, false
+	}
+	return data, true
+}
+
+func errorsPayload(message string) json.RawMessage {
+	payload, _ := json.Marshal([]map[string]string{{"message": message}})
+	return payload
+}
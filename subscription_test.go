@@ -0,0 +1,215 @@
+package brick
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	websocket "github.com/gorilla/websocket"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func dialGraphql(t *testing.T, s *httptest.Server) *websocket.Conn {
+	dialer := websocket.Dialer{Subprotocols: []string{graphqlTransportWS}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/graphql", nil)
+	assert.Nil(t, err)
+	return conn
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) string {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+func TestSubscriptionWebSocket(t *testing.T) {
+	g := NewGraphql(&relayResolver{})
+	g.Schema(`
+	type Query {
+		greeting(name: String): String!
+	}
+	type Subscription {
+		tick(n: Int!): Int!
+	}
+	`)
+	var token interface{}
+	g.Subscriptions(&SubscriptionConfig{
+		OnInit: func(ctx context.Context, payload map[string]interface{}) (context.Context, error) {
+			if payload["token"] == "bad" {
+				return nil, errors.New("forbidden")
+			}
+			token = GraphqlInitPayload(ctx)["token"]
+			return ctx, nil
+		},
+	})
+	r := New()
+	r.Graphql("/graphql", g)
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	conn := dialGraphql(t, s)
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{"type": "connection_init", "payload": map[string]string{"token": "t"}})
+	assert.Equal(t, `{"type":"connection_ack"}`+"\n", readMessage(t, conn))
+	assert.Equal(t, "t", token)
+
+	conn.WriteJSON(map[string]string{"type": "ping"})
+	assert.Equal(t, `{"type":"pong"}`+"\n", readMessage(t, conn))
+
+	conn.WriteJSON(map[string]interface{}{
+		"id":      "1",
+		"type":    "subscribe",
+		"payload": map[string]string{"query": "subscription { tick(n: 2) }"},
+	})
+	assert.Equal(t, `{"id":"1","type":"next","payload":{"data":{"tick":1}}}`+"\n", readMessage(t, conn))
+	assert.Equal(t, `{"id":"1","type":"next","payload":{"data":{"tick":2}}}`+"\n", readMessage(t, conn))
+	assert.Equal(t, `{"id":"1","type":"complete"}`+"\n", readMessage(t, conn))
+
+	// queries work too
+	conn.WriteJSON(map[string]interface{}{
+		"id":      "2",
+		"type":    "subscribe",
+		"payload": map[string]string{"query": "{ greeting }"},
+	})
+	assert.Equal(t, `{"id":"2","type":"next","payload":{"data":{"greeting":"hello world"}}}`+"\n", readMessage(t, conn))
+	assert.Equal(t, `{"id":"2","type":"complete"}`+"\n", readMessage(t, conn))
+
+	conn.WriteJSON(map[string]interface{}{
+		"id":      "3",
+		"type":    "subscribe",
+		"payload": map[string]string{"query": "subscription { unknown }"},
+	})
+	assert.Contains(t, readMessage(t, conn), `{"id":"3","type":"error","payload":[{"message":"Cannot query field`)
+
+	// duplicated connection_init
+	conn.WriteJSON(map[string]string{"type": "connection_init"})
+	assert.Equal(t, "websocket: close 4429: Too many initialisation requests", readMessage(t, conn))
+
+	// subscribe before connection_init
+	conn = dialGraphql(t, s)
+	conn.WriteJSON(map[string]interface{}{"id": "1", "type": "subscribe", "payload": map[string]string{"query": "{ greeting }"}})
+	assert.Equal(t, "websocket: close 4401: Unauthorized", readMessage(t, conn))
+
+	// rejected by OnInit
+	conn = dialGraphql(t, s)
+	conn.WriteJSON(map[string]interface{}{"type": "connection_init", "payload": map[string]string{"token": "bad"}})
+	assert.Equal(t, "websocket: close 4403: Forbidden", readMessage(t, conn))
+}
+
+func TestSubscriptionShutdown(t *testing.T) {
+	r := newRelayRouter()
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	conn := dialGraphql(t, s)
+	defer conn.Close()
+	conn.WriteJSON(map[string]string{"type": "connection_init"})
+	readMessage(t, conn)
+	conn.WriteJSON(map[string]interface{}{
+		"id":      "1",
+		"type":    "subscribe",
+		"payload": map[string]string{"query": "subscription { tick(n: 0) }"},
+	})
+	readMessage(t, conn)
+
+	sse, err := http.NewRequest("GET", s.URL+"/graphql?query="+url.QueryEscape("subscription { tick(n: 0) }"), nil)
+	assert.Nil(t, err)
+	sse.Header.Set("Accept", "text/event-stream")
+	res, err := http.DefaultClient.Do(sse)
+	assert.Nil(t, err)
+	defer res.Body.Close()
+
+	assert.Nil(t, r.Shutdown(context.Background()))
+
+	var last string
+	for {
+		msg := readMessage(t, conn)
+		if strings.HasPrefix(msg, "websocket: close") {
+			last = msg
+			break
+		}
+	}
+	assert.Equal(t, "websocket: close 1001 (going away): Server shutdown", last)
+
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		last = scanner.Text()
+		if last == "event: complete" {
+			break
+		}
+	}
+	assert.Equal(t, "event: complete", last)
+}
+
+func TestSubscriptionEventStream(t *testing.T) {
+	r := newRelayRouter()
+
+	cases := []struct {
+		query    string
+		status   int
+		response string
+	}{
+		{
+			"subscription { tick(n: 2) }", 200,
+			"event: next\ndata: {\"data\":{\"tick\":1}}\n\n" +
+				"event: next\ndata: {\"data\":{\"tick\":2}}\n\n" +
+				"event: complete\ndata:\n\n",
+		},
+		{
+			"{ greeting }", 200,
+			"event: next\ndata: {\"data\":{\"greeting\":\"hello world\"}}\n\n" +
+				"event: complete\ndata:\n\n",
+		},
+		{
+			"mutation { touch }", 405,
+			`{"errors":[{"message":"only queries are allowed by GET"}]}` + "\n",
+		},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/graphql?query="+url.QueryEscape(c.query), nil)
+		req.Header.Set("Accept", "text/event-stream")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, c.status, w.Code, c.query)
+		assert.Equal(t, c.response, w.Body.String(), c.query)
+	}
+
+	// subscriptions require a stream
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/graphql?query="+url.QueryEscape("subscription { tick(n: 2) }"), nil))
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestSubscriptionEventStreamError(t *testing.T) {
+	// failed to subscribe after the stream is started
+	g := NewGraphql(nil)
+	g.Schema(`
+	type Query {
+		greeting: String!
+	}
+	`)
+	r := New()
+	r.Graphql("/graphql", g)
+
+	req := httptest.NewRequest("GET", "/graphql?query="+url.QueryEscape("{ greeting }"), nil)
+	req.Header.Set("Accept", "text/event-stream")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(
+		t,
+		"event: next\ndata: {\"errors\":[{\"message\":\"internal error\"}]}\n\n"+
+			"event: complete\ndata:\n\n",
+		w.Body.String(),
+	)
+}
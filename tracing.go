@@ -0,0 +1,202 @@
+package brick
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	introspection "github.com/graph-gophers/graphql-go/introspection"
+	trace "github.com/graph-gophers/graphql-go/trace"
+	ot "github.com/opentracing/opentracing-go"
+	otext "github.com/opentracing/opentracing-go/ext"
+	bm "github.com/pickjunk/brick/metrics"
+	ast "github.com/vektah/gqlparser/v2/ast"
+	parser "github.com/vektah/gqlparser/v2/parser"
+)
+
+// TracingConfig of spans and metrics of graphql resolvers
+type TracingConfig struct {
+	// Redact values of arguments, and fields of input objects, whose
+	// names contain any of these, case-insensitively,
+	// password, secret and token if nil
+	Redact []string
+	// TrivialFields trace fields resolved without context or error too,
+	// e.g. fields of structs, which are skipped by default
+	TrivialFields bool
+}
+
+var defaultRedact = []string{"password", "secret", "token"}
+
+// replacement of redacted values
+const redacted = "[REDACTED]"
+
+// Tracing enable spans of parse, validate, execute and every resolver
+// field, which are tagged by the path and the arguments of the field,
+// latencies of fields are observed by
+// brick_graphql_field_duration_seconds as well. It is disabled by
+// default, nil disables it again
+func (g *Graphql) Tracing(cfg *TracingConfig) *Graphql {
+	if cfg == nil {
+		g.tracing = nil
+		return g
+	}
+	c := *cfg
+	if c.Redact == nil {
+		c.Redact = defaultRedact
+	}
+	g.tracing = &c
+	return g
+}
+
+// graphqlTracer implements trace.Tracer of graphql-go
+type graphqlTracer struct {
+	*TracingConfig
+}
+
+func newGraphqlTracer(cfg *TracingConfig) trace.Tracer {
+	if cfg == nil {
+		return trace.NoopTracer{}
+	}
+	return &graphqlTracer{cfg}
+}
+
+// validation of an execution, graphql-go parses and validates the
+// query before TraceQuery without a context, so validation is traced
+// from the start of Exec to TraceQuery, or to the end of Exec if the
+// query is rejected
+type validation struct {
+	start time.Time
+	done  bool
+}
+
+func (v *validation) finish(ctx context.Context, errs []*gqlerrors.QueryError) {
+	if v == nil || v.done {
+		return
+	}
+	v.done = true
+
+	span, _ := ot.StartSpanFromContext(ctx, "graphql.validate", ot.StartTime(v.start))
+	if len(errs) > 0 {
+		otext.Error.Set(span, true)
+		span.SetTag("graphql.errors", len(errs))
+	}
+	span.Finish()
+}
+
+func (t *graphqlTracer) TraceQuery(ctx context.Context, queryString string, operationName string, variables map[string]interface{}, varTypes map[string]*introspection.Type) (context.Context, trace.TraceQueryFinishFunc) {
+	v, _ := value(ctx, "graphql_validation").(*validation)
+	v.finish(ctx, nil)
+
+	span, spanCtx := ot.StartSpanFromContext(ctx, "graphql.execute")
+	if operationName != "" {
+		span.SetTag("graphql.operation", operationName)
+	}
+
+	return spanCtx, func(errs []*gqlerrors.QueryError) {
+		if len(errs) > 0 {
+			span.SetTag("graphql.errors", len(errs))
+		}
+		span.Finish()
+	}
+}
+
+func (t *graphqlTracer) TraceField(ctx context.Context, label, typeName, fieldName string, trivial bool, args map[string]interface{}) (context.Context, trace.TraceFieldFinishFunc) {
+	// graphql-go does not pass the path, so the path of the parent is
+	// kept in the context, list indexes are left out
+	path := fieldName
+	if parent, ok := value(ctx, "graphql_path").(string); ok {
+		path = parent + "." + fieldName
+	}
+	ctx = withValue(ctx, "graphql_path", path)
+
+	if (trivial && !t.TrivialFields) || isIntrospectionField(fieldName) {
+		return ctx, func(*gqlerrors.QueryError) {}
+	}
+
+	span, spanCtx := ot.StartSpanFromContext(ctx, typeName+"."+fieldName)
+	span.SetTag("graphql.type", typeName)
+	span.SetTag("graphql.field", fieldName)
+	span.SetTag("graphql.path", path)
+	if len(args) > 0 {
+		if data, err := json.Marshal(t.redact(args)); err == nil {
+			span.SetTag("graphql.args", string(data))
+		}
+	}
+
+	// graphql-go finishes a field after its children are resolved,
+	// so the duration includes them
+	start := time.Now()
+	return spanCtx, func(err *gqlerrors.QueryError) {
+		duration := time.Now().Sub(start)
+
+		result := "ok"
+		if err != nil {
+			result = "error"
+			span.SetTag("graphql.error", err.Message)
+			// business errors are expected, not failures of the span
+			if businessError(err) == nil {
+				otext.Error.Set(span, true)
+			}
+		}
+		span.Finish()
+
+		bm.GraphqlFieldDuration.WithLabelValues(typeName, fieldName, result).Observe(duration.Seconds())
+	}
+}
+
+// redact a copy of v, values of keys matching Redact are replaced
+func (t *graphqlTracer) redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, elem := range v {
+			if t.sensitive(k) {
+				m[k] = redacted
+			} else {
+				m[k] = t.redact(elem)
+			}
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, elem := range v {
+			list[i] = t.redact(elem)
+		}
+		return list
+	}
+	return v
+}
+
+func (t *graphqlTracer) sensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range t.Redact {
+		if s != "" && strings.Contains(name, strings.ToLower(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// parse the query of params into params.doc with a span, errors are
+// left to the execution, which reports them to the client
+func (e *graphqlEndpoint) parse(ctx context.Context, params *graphqlParams) {
+	var span ot.Span
+	if e.tracing != nil {
+		span, _ = ot.StartSpanFromContext(ctx, "graphql.parse")
+	}
+
+	doc, err := parser.ParseQuery(&ast.Source{Input: params.Query})
+	if err == nil {
+		params.doc = doc
+	}
+
+	if span != nil {
+		if err != nil {
+			otext.Error.Set(span, true)
+			span.SetTag("graphql.error", err.Error())
+		}
+		span.Finish()
+	}
+}
@@ -0,0 +1,133 @@
+package brick
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ot "github.com/opentracing/opentracing-go"
+	mocktracer "github.com/opentracing/opentracing-go/mocktracer"
+	assert "github.com/stretchr/testify/assert"
+)
+
+type tracingResolver struct{}
+
+type tracingLogin struct {
+	Name     string
+	Password string
+}
+
+func (r *tracingResolver) Login(ctx context.Context, args struct{ Input tracingLogin }) (*tracingUser, error) {
+	return &tracingUser{args.Input.Name}, nil
+}
+
+type tracingUser struct {
+	name string
+}
+
+func (u *tracingUser) Name() string {
+	return u.name
+}
+
+func (u *tracingUser) Friend(ctx context.Context) *tracingUser {
+	return &tracingUser{u.name + "'s friend"}
+}
+
+func TestTracing(t *testing.T) {
+	assert := assert.New(t)
+
+	tracer := mocktracer.New()
+	origin := ot.GlobalTracer()
+	ot.SetGlobalTracer(tracer)
+	defer ot.SetGlobalTracer(origin)
+
+	g := NewGraphql(&tracingResolver{}).Tracing(&TracingConfig{})
+	g.Schema(`
+	input LoginInput {
+		name: String!
+		password: String!
+	}
+	type User {
+		name: String!
+		friend: User!
+	}
+	type Query {
+		login(input: LoginInput!): User!
+	}
+	`)
+	r := New()
+	r.Metrics("/metrics")
+	r.Graphql("/graphql", g)
+
+	req := httptest.NewRequest("POST", "/graphql", strings.NewReader(
+		`{"query":"query q { login(input: {name: \"bob\", password: \"123456\"}) { name friend { name } } }"}`,
+	))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(`{"data":{"login":{"name":"bob","friend":{"name":"bob's friend"}}}}`, w.Body.String())
+
+	spans := map[string]*mocktracer.MockSpan{}
+	for _, span := range tracer.FinishedSpans() {
+		spans[span.OperationName] = span
+	}
+	for _, name := range []string{"http", "graphql", "graphql.parse", "graphql.validate", "graphql.execute", "Query.login", "User.friend"} {
+		assert.Contains(spans, name)
+	}
+	// trivial fields are skipped
+	assert.NotContains(spans, "User.name")
+
+	tags := func(name string) map[string]interface{} {
+		return spans[name].Tags()
+	}
+	assert.Equal("login", tags("Query.login")["graphql.path"])
+	assert.Equal(`{"input":{"name":"bob","password":"[REDACTED]"}}`, tags("Query.login")["graphql.args"])
+	assert.Equal("login.friend", tags("User.friend")["graphql.path"])
+	assert.Equal(
+		spans["Query.login"].SpanContext.SpanID,
+		spans["User.friend"].ParentID,
+	)
+	assert.Equal(
+		spans["graphql"].SpanContext.SpanID,
+		spans["graphql.validate"].ParentID,
+	)
+
+	// rejected by validation
+	tracer.Reset()
+	req = httptest.NewRequest("POST", "/graphql", strings.NewReader(`{"query":"{ logout }"}`))
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	spans = map[string]*mocktracer.MockSpan{}
+	for _, span := range tracer.FinishedSpans() {
+		spans[span.OperationName] = span
+	}
+	assert.Equal(true, tags("graphql.validate")["error"])
+	assert.NotContains(spans, "graphql.execute")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(w.Body.String(), `brick_graphql_field_duration_seconds_count{field="friend",result="ok",type="User"} 1`)
+}
+
+func TestTracingDisabled(t *testing.T) {
+	tracer := mocktracer.New()
+	origin := ot.GlobalTracer()
+	ot.SetGlobalTracer(tracer)
+	defer ot.SetGlobalTracer(origin)
+
+	// disabled by default
+	g := NewGraphql(&relayResolver{})
+	g.Schema(`
+	type Query {
+		greeting(name: String): String!
+	}
+	`)
+	r := New()
+	r.Graphql("/graphql", g)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/graphql?query=%7Bgreeting%7D", nil))
+
+	var names []string
+	for _, span := range tracer.FinishedSpans() {
+		names = append(names, span.OperationName)
+	}
+	assert.ElementsMatch(t, []string{"http", "graphql"}, names)
+}
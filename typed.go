@@ -0,0 +1,161 @@
+package brick
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	be "github.com/pickjunk/brick/error"
+)
+
+// TypedHandle is a Handle with its input and output types,
+// created by JSON, the types are used by the OpenAPI document
+type TypedHandle struct {
+	Handle Handle
+	In     reflect.Type
+	Out    reflect.Type
+	// name of the typed func
+	name string
+}
+
+// JSON adapt a typed func as a TypedHandle. In (a struct or pointer to struct)
+// is filled by Bind, Out is encoded as JSON, or XML if the Accept header
+// prefers it. Returned errors are responded without panics:
+//
+//	*BindError              400 with the BindError
+//	error.BusinessError     200 with {"code":...,"msg":...}, like recover middleware,
+//	                        a pointer or a value, wrapped or not
+//	others                  500 Internal Server Error, logged
+func JSON[In any, Out any](fn func(context.Context, In) (Out, error)) *TypedHandle {
+	inType := reflect.TypeOf((*In)(nil)).Elem()
+	isPtr := inType.Kind() == reflect.Ptr
+	if isPtr {
+		inType = inType.Elem()
+	}
+	if inType.Kind() != reflect.Struct {
+		log.Panic().Msgf("expect a struct or pointer to struct as input, but get %s", inType)
+	}
+
+	handle := func(ctx context.Context) {
+		var in In
+		target := interface{}(&in)
+		if isPtr {
+			v := reflect.New(inType)
+			reflect.ValueOf(&in).Elem().Set(v)
+			target = v.Interface()
+		}
+		if err := Bind(ctx, target); err != nil {
+			writeError(ctx, err)
+			return
+		}
+
+		out, err := fn(ctx, in)
+		if err != nil {
+			writeError(ctx, err)
+			return
+		}
+
+		encode(ctx, http.StatusOK, out)
+	}
+
+	return &TypedHandle{
+		Handle: handle,
+		In:     inType,
+		Out:    reflect.TypeOf((*Out)(nil)).Elem(),
+		name:   funcName(fn),
+	}
+}
+
+// writeError respond err, or the first BindError or BusinessError
+// (a pointer or a value) it wraps
+func writeError(ctx context.Context, err error) {
+	var bindErr *BindError
+	var bizPtr *be.BusinessError
+	var biz be.BusinessError
+	switch {
+	case errors.As(err, &bindErr):
+		encode(ctx, http.StatusBadRequest, bindErr)
+	case errors.As(err, &bizPtr) && bizPtr != nil:
+		encode(ctx, http.StatusOK, bizPtr)
+	case errors.As(err, &biz):
+		encode(ctx, http.StatusOK, biz)
+	default:
+		log.Error().Err(err).Send()
+		http.Error(Response(ctx), "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// negotiate pick the response content type from offers by the Accept
+// header, the first offer if Accept is empty, or empty if none is acceptable
+func negotiate(accept string, offers ...string) string {
+	if accept == "" {
+		return offers[0]
+	}
+
+	type mediaRange struct {
+		mediaType string
+		q         float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, mediaRange{mediaType, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	for _, r := range ranges {
+		for _, offer := range offers {
+			if r.mediaType == offer || r.mediaType == "*/*" ||
+				strings.HasSuffix(r.mediaType, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(r.mediaType, "*")) {
+				return offer
+			}
+		}
+	}
+	return ""
+}
+
+func encode(ctx context.Context, status int, v interface{}) {
+	w := Response(ctx)
+
+	contentType := negotiate(Request(ctx).Header.Get("Accept"), "application/json", "application/xml", "text/xml")
+	var body []byte
+	var err error
+	switch contentType {
+	case "application/json":
+		body, err = json.Marshal(v)
+	case "application/xml", "text/xml":
+		body, err = xml.Marshal(v)
+	default:
+		http.Error(w, "Not Acceptable", http.StatusNotAcceptable)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Send()
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(body)
+}
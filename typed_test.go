@@ -0,0 +1,85 @@
+package brick
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	be "github.com/pickjunk/brick/error"
+	assert "github.com/stretchr/testify/assert"
+)
+
+type greetIn struct {
+	Name string `path:"name" validate:"max=5"`
+	Fail string `query:"fail"`
+}
+
+type greetOut struct {
+	Greeting string `json:"greeting" xml:"greeting"`
+}
+
+func greet(ctx context.Context, in greetIn) (greetOut, error) {
+	switch in.Fail {
+	case "business":
+		return greetOut{}, &be.BusinessError{Code: 10001, Msg: "business"}
+	case "value":
+		return greetOut{}, be.BusinessError{Code: 10002, Msg: "value"}
+	case "wrapped":
+		return greetOut{}, fmt.Errorf("greet: %w", &be.BusinessError{Code: 10003, Msg: "wrapped"})
+	case "internal":
+		return greetOut{}, errors.New("internal")
+	}
+	return greetOut{Greeting: "hello " + in.Name}, nil
+}
+
+func TestJSON(t *testing.T) {
+	r := New()
+	r.GET("/greet/:name", JSON(greet))
+	r.POST("/echo", JSON(func(ctx context.Context, in *struct {
+		Text string `json:"text" validate:"required"`
+	}) (map[string]string, error) {
+		return map[string]string{"text": in.Text}, nil
+	}))
+
+	cases := []struct {
+		method, path, accept, body string
+		status                     int
+		contentType, response      string
+	}{
+		{"GET", "/greet/bob", "", "", 200, "application/json; charset=utf-8", `{"greeting":"hello bob"}`},
+		{"GET", "/greet/bob", "text/html, application/xml;q=0.9, */*;q=0.1", "", 200, "application/xml; charset=utf-8", `<greetOut><greeting>hello bob</greeting></greetOut>`},
+		{"GET", "/greet/bob", "text/html", "", 406, "text/plain; charset=utf-8", "Not Acceptable\n"},
+		{"GET", "/greet/toolong", "", "", 400, "application/json; charset=utf-8", `{"code":400,"msg":"name: length must be at most 5","fields":[{"field":"name","msg":"length must be at most 5"}]}`},
+		{"GET", "/greet/bob?fail=business", "", "", 200, "application/json; charset=utf-8", `{"code":10001,"msg":"business"}`},
+		{"GET", "/greet/bob?fail=value", "", "", 200, "application/json; charset=utf-8", `{"code":10002,"msg":"value"}`},
+		{"GET", "/greet/bob?fail=wrapped", "", "", 200, "application/json; charset=utf-8", `{"code":10003,"msg":"wrapped"}`},
+		{"GET", "/greet/bob?fail=internal", "", "", 500, "text/plain; charset=utf-8", "Internal Server Error\n"},
+		{"POST", "/echo", "application/json", `{"text":"hi"}`, 200, "application/json; charset=utf-8", `{"text":"hi"}`},
+		{"POST", "/echo", "application/json", `{}`, 400, "application/json; charset=utf-8", `{"code":400,"msg":"text: required","fields":[{"field":"text","msg":"required"}]}`},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		if c.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.accept != "" {
+			req.Header.Set("Accept", c.accept)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, c.status, w.Code, c.path)
+		assert.Equal(t, c.contentType, w.Header().Get("Content-Type"), c.path)
+		assert.Equal(t, c.response, w.Body.String(), c.path)
+	}
+
+	assert.Panics(t, func() {
+		JSON(func(ctx context.Context, in string) (string, error) {
+			return in, nil
+		})
+	})
+}
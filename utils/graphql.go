@@ -1,14 +1,24 @@
 package utils
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	req "github.com/imroc/req"
+	b "github.com/pickjunk/brick"
 	be "github.com/pickjunk/brick/error"
+	ast "github.com/vektah/gqlparser/v2/ast"
+	parser "github.com/vektah/gqlparser/v2/parser"
 )
 
 // Graphql struct
@@ -18,60 +28,308 @@ type Graphql struct {
 	Variables map[string]interface{}
 	Operation string
 	Headers   req.Header
+	// Client of the request, for retries and timeouts, a client
+	// without them if nil, URL and Headers above take precedence
+	Client *GraphqlClient
 }
 
-// Fetch execute a graphql api
+// Fetch execute a graphql api, result receives the whole response
+// (data and errors), so partial data is kept along with the error,
+// which is a *be.BusinessError for a single business error, or
+// GraphqlErrors for more than one error
 func (g *Graphql) Fetch(ctx context.Context, result interface{}) error {
-	if os.Getenv("DEBUG") == "true" {
-		req.Debug = true
-		defer func() {
-			req.Debug = false
-		}()
+	c := g.Client
+	if c == nil {
+		c = &GraphqlClient{Debug: os.Getenv("DEBUG") == "true"}
 	}
 
-	r := req.New()
+	res, err := c.Do(ctx, &GraphqlRequest{
+		URL:           g.URL,
+		Query:         g.Query,
+		OperationName: g.Operation,
+		Variables:     g.Variables,
+		Headers:       g.Headers,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(res.body, result); err != nil {
+		return err
+	}
+
+	switch len(res.Errors) {
+	case 0:
+		return nil
+	case 1:
+		return res.Errors[0].Unwrap()
+	}
+	return res.Errors
+}
+
+// GraphqlClient is a reusable client of graphql apis, safe for
+// concurrent use, queries are retried on network errors, 429 and 5xx,
+// mutations never are
+type GraphqlClient struct {
+	// URL of the endpoint
+	URL string
+	// Headers of every request
+	Headers req.Header
+	// Transport of requests, which are sent by brick.DefaultClient
+	// if nil, or by a brick.Client of it
+	Transport http.RoundTripper
+	// Timeout of every attempt, zero for no timeout
+	Timeout time.Duration
+	// Retries of a query after the first attempt
+	Retries int
+	// Backoff before the nth retry, from 1, 100ms doubled every retry
+	// up to 3s, with jitter, if nil
+	Backoff func(n int) time.Duration
+	// Debug log requests and responses by the logger of brick
+	Debug bool
+
+	once   sync.Once
+	client *b.Client
+}
+
+// GraphqlRequest of GraphqlClient.Do
+type GraphqlRequest struct {
+	// URL of the request, the URL of the client if empty
+	URL           string
+	Query         string
+	OperationName string
+	Variables     map[string]interface{}
+	// Headers of the request, in addition to the headers of the client
+	Headers req.Header
+	// Timeout of every attempt, the Timeout of the client if zero
+	Timeout time.Duration
+}
+
+// GraphqlResponse of a request, Data may be partial with Errors
+type GraphqlResponse struct {
+	Data       json.RawMessage        `json:"data"`
+	Errors     GraphqlErrors          `json:"errors"`
+	Extensions map[string]interface{} `json:"extensions"`
+	// the raw body
+	body []byte
+}
+
+// Decode the data of the response into v
+func (r *GraphqlResponse) Decode(v interface{}) error {
+	if len(r.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(r.Data, v)
+}
+
+// GraphqlError of a response
+type GraphqlError struct {
+	Message   string        `json:"message"`
+	Path      []interface{} `json:"path,omitempty"`
+	Locations []struct {
+		Line   int `json:"line"`
+		Column int `json:"column"`
+	} `json:"locations,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (e *GraphqlError) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+	path := make([]string, len(e.Path))
+	for i, p := range e.Path {
+		path[i] = fmt.Sprint(p)
+	}
+	return strings.Join(path, ".") + ": " + e.Message
+}
+
+// Unwrap the error as a *be.BusinessError if it has a code,
+// see graphqlError
+func (e *GraphqlError) Unwrap() error {
+	return graphqlError(e.Message, e.Extensions)
+}
+
+// GraphqlErrors of a response, in order
+type GraphqlErrors []*GraphqlError
+
+func (e GraphqlErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap for errors.As to find business errors of any of them
+func (e GraphqlErrors) Unwrap() []error {
+	list := make([]error, len(e))
+	for i, err := range e {
+		list[i] = err
+	}
+	return list
+}
+
+func (c *GraphqlClient) httpClient() *b.Client {
+	if c.Transport == nil {
+		return b.DefaultClient
+	}
+	c.once.Do(func() {
+		c.client = &b.Client{Transport: c.Transport}
+	})
+	return c.client
+}
+
+// Do execute the request, errors of transport and http status are
+// returned as error, errors of graphql are in the response
+func (c *GraphqlClient) Do(ctx context.Context, request *GraphqlRequest) (*GraphqlResponse, error) {
+	url := request.URL
+	if url == "" {
+		url = c.URL
+	}
+	timeout := request.Timeout
+	if timeout == 0 {
+		timeout = c.Timeout
+	}
+	headers := req.Header{}
+	for k, v := range c.Headers {
+		headers[k] = v
+	}
+	for k, v := range request.Headers {
+		headers[k] = v
+	}
 
 	params := map[string]interface{}{
-		"query": g.Query,
+		"query": request.Query,
+	}
+	if request.OperationName != "" {
+		params["operationName"] = request.OperationName
+	}
+	if request.Variables != nil {
+		params["variables"] = request.Variables
+	}
+
+	retries := 0
+	if isQuery(request.Query, request.OperationName) {
+		retries = c.Retries
+	}
+
+	for n := 0; ; n++ {
+		res, retry, err := c.attempt(ctx, url, timeout, headers, params)
+		if err == nil || !retry || n >= retries {
+			return res, err
+		}
+
+		backoff := c.backoff(n + 1)
+		log.Warn().Err(err).Str("url", url).Int("retry", n+1).Dur("backoff", backoff).Msg("graphql retry")
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(backoff):
+		}
 	}
-	if g.Variables != nil {
-		params["variables"] = g.Variables
+}
+
+// attempt to execute the request once, retry is true if the error
+// is transient
+func (c *GraphqlClient) attempt(ctx context.Context, url string, timeout time.Duration, headers req.Header, params map[string]interface{}) (*GraphqlResponse, bool, error) {
+	parent := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
-	if g.Variables != nil {
-		params["operation"] = g.Operation
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, false, err
 	}
-	res, err := r.Post(g.URL, g.Headers, req.BodyJSON(params), ctx)
+	r, err := http.NewRequest("POST", url, bytes.NewReader(data))
 	if err != nil {
-		return err
+		return nil, false, err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		r.Header.Set(k, v)
 	}
 
-	code := res.Response().StatusCode
-	if !(code >= 200 && code < 300) {
-		return fmt.Errorf("http status error: %d", code)
+	res, err := c.httpClient().Do(ctx, "graphql.fetch", r)
+	if err != nil {
+		// attempts timed out are retried, unless the parent is done
+		return nil, err != b.ErrCircuitOpen && parent.Err() == nil, err
 	}
+	defer res.Body.Close()
 
-	var e struct {
-		Errors []struct {
-			Message string
-		}
+	body, err := io.ReadAll(res.Body)
+	if c.Debug {
+		log.Debug().RawJSON("request", data).Int("status", res.StatusCode).Bytes("response", body).Msg("graphql fetch")
 	}
-	err = res.ToJSON(&e)
 	if err != nil {
-		return err
+		return nil, parent.Err() == nil, err
+	}
+
+	code := res.StatusCode
+	if code >= 500 || code == http.StatusTooManyRequests {
+		return nil, true, fmt.Errorf("http status error: %d", code)
 	}
-	if len(e.Errors) > 0 {
-		var bErr be.BusinessError
-		err = json.Unmarshal([]byte(e.Errors[0].Message), &bErr)
-		if err != nil {
-			return errors.New(e.Errors[0].Message)
+
+	response := &GraphqlResponse{body: body}
+	err = json.Unmarshal(body, response)
+	if code < 200 || code >= 300 {
+		// GraphQL-over-HTTP responds 4xx with errors, for requests
+		// rejected before execution
+		if err != nil || len(response.Errors) == 0 {
+			return nil, false, fmt.Errorf("http status error: %d", code)
 		}
-		return &bErr
+		return response, false, nil
+	}
+	if err != nil {
+		return nil, false, err
 	}
+	return response, false, nil
+}
 
-	err = res.ToJSON(result)
+func (c *GraphqlClient) backoff(n int) time.Duration {
+	if c.Backoff != nil {
+		return c.Backoff(n)
+	}
+	d := 100 * time.Millisecond << uint(n-1)
+	if d > 3*time.Second || d <= 0 {
+		d = 3 * time.Second
+	}
+	// jitter of [d/2, d)
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+// isQuery return true if the operation to execute is a query,
+// which is idempotent and safe to retry
+func isQuery(query, operationName string) bool {
+	doc, err := parser.ParseQuery(&ast.Source{Input: query})
 	if err != nil {
-		return err
+		return false
 	}
+	for _, op := range doc.Operations {
+		if op.Name == operationName || len(doc.Operations) == 1 {
+			return op.Operation == ast.Query
+		}
+	}
+	return false
+}
 
-	return nil
+// graphqlError is a BusinessError if there is a numeric code in
+// extensions, or the message is of the legacy format {"code":...,"msg":...}
+func graphqlError(message string, extensions map[string]interface{}) error {
+	if code, ok := extensions["code"].(float64); ok {
+		bErr := &be.BusinessError{Code: int(code), Msg: message}
+		// servers of LegacyErrors
+		json.Unmarshal([]byte(message), bErr)
+		return bErr
+	}
+
+	var bErr be.BusinessError
+	err := json.Unmarshal([]byte(message), &bErr)
+	if err != nil {
+		return errors.New(message)
+	}
+	return &bErr
 }
@@ -2,9 +2,14 @@ package utils
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"net/http"
+	"net/http/httptest"
 	"regexp"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -153,3 +158,106 @@ func TestGraphql(t *testing.T) {
 		t.Errorf("result not correct")
 	}
 }
+
+func TestGraphqlError(t *testing.T) {
+	err := graphqlError("test error", map[string]interface{}{"code": float64(100)})
+	bErr, ok := err.(*be.BusinessError)
+	if !ok || bErr.Code != 100 || bErr.Msg != "test error" {
+		t.Errorf("can not parse extensions correctly")
+	}
+
+	// servers of LegacyErrors
+	err = graphqlError(`{"code":100,"msg":"test error"}`, map[string]interface{}{"code": float64(100)})
+	bErr, ok = err.(*be.BusinessError)
+	if !ok || bErr.Code != 100 || bErr.Msg != "test error" {
+		t.Errorf("can not parse legacy message with extensions correctly")
+	}
+
+	// legacy servers
+	err = graphqlError(`{"code":100,"msg":"test error"}`, nil)
+	bErr, ok = err.(*be.BusinessError)
+	if !ok || bErr.Code != 100 || bErr.Msg != "test error" {
+		t.Errorf("can not parse legacy message correctly")
+	}
+
+	err = graphqlError("masked panic", nil)
+	if _, ok := err.(*be.BusinessError); ok || err.Error() != "masked panic" {
+		t.Errorf("can not parse error correctly")
+	}
+}
+
+func TestGraphqlClient(t *testing.T) {
+	var attempts int32
+	var operationName atomic.Value
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var params map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&params)
+		operationName.Store(fmt.Sprint(params["operationName"]))
+		switch r.URL.Path {
+		case "/flaky":
+			if atomic.AddInt32(&attempts, 1) < 3 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+		case "/slow":
+			if atomic.AddInt32(&attempts, 1) < 2 {
+				time.Sleep(100 * time.Millisecond)
+			}
+		case "/partial":
+			w.Write([]byte(`{"data":{"a":1,"b":null},"errors":[{"message":"b failed","path":["b"],"extensions":{"code":100}},{"message":"c failed","path":["c"]}]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"a":1}}`))
+	}))
+	defer s.Close()
+
+	c := &GraphqlClient{
+		URL:     s.URL + "/flaky",
+		Retries: 2,
+		Backoff: func(n int) time.Duration { return time.Millisecond },
+	}
+
+	// queries are retried
+	res, err := c.Do(context.Background(), &GraphqlRequest{Query: "query a { a } mutation b { b }", OperationName: "a"})
+	if err != nil || string(res.Data) != `{"a":1}` || atomic.LoadInt32(&attempts) != 3 {
+		t.Errorf("can not retry queries: %v, %d attempts", err, attempts)
+	}
+	// operationName is sent without variables
+	if operationName.Load() != "a" {
+		t.Errorf("operationName not sent: %v", operationName.Load())
+	}
+
+	// mutations are not
+	atomic.StoreInt32(&attempts, 0)
+	_, err = c.Do(context.Background(), &GraphqlRequest{Query: "query a { a } mutation b { b }", OperationName: "b"})
+	if err == nil || err.Error() != "http status error: 503" || atomic.LoadInt32(&attempts) != 1 {
+		t.Errorf("should not retry mutations: %v, %d attempts", err, attempts)
+	}
+
+	// attempts timed out are retried
+	atomic.StoreInt32(&attempts, 0)
+	res, err = c.Do(context.Background(), &GraphqlRequest{URL: s.URL + "/slow", Query: "{ a }", Timeout: 20 * time.Millisecond})
+	if err != nil || string(res.Data) != `{"a":1}` || atomic.LoadInt32(&attempts) != 2 {
+		t.Errorf("can not retry timeouts: %v, %d attempts", err, attempts)
+	}
+
+	// partial data and every error
+	res, err = c.Do(context.Background(), &GraphqlRequest{URL: s.URL + "/partial", Query: "{ a b c }"})
+	if err != nil || len(res.Errors) != 2 || res.Errors.Error() != "b: b failed; c: c failed" {
+		t.Errorf("can not parse errors: %v, %v", err, res.Errors)
+	}
+	var data struct{ A int }
+	if res.Decode(&data) != nil || data.A != 1 {
+		t.Errorf("can not decode partial data")
+	}
+
+	var result struct {
+		Data struct{ A int }
+	}
+	g := Graphql{URL: s.URL + "/partial", Query: "{ a b c }"}
+	err = g.Fetch(context.Background(), &result)
+	var bErr *be.BusinessError
+	if result.Data.A != 1 || !errors.As(err, &bErr) || bErr.Code != 100 {
+		t.Errorf("can not fetch partial data with errors: %v", err)
+	}
+}
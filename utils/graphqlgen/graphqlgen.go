@@ -0,0 +1,405 @@
+// Package graphqlgen generate typed Go functions of graphql operations,
+// with structs of variables and results, which call through
+// utils.Graphql.Fetch, so that typos of queries are caught by go build
+package graphqlgen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	gqlparser "github.com/vektah/gqlparser/v2"
+	ast "github.com/vektah/gqlparser/v2/ast"
+	formatter "github.com/vektah/gqlparser/v2/formatter"
+	parser "github.com/vektah/gqlparser/v2/parser"
+	validator "github.com/vektah/gqlparser/v2/validator"
+)
+
+// Config of Generate
+type Config struct {
+	// Package of the generated file
+	Package string
+	// Schema is the SDL of the server, see LoadSchema
+	Schema string
+	// Operations are .graphql files of named operations and fragments,
+	// fragments are shared by all of them
+	Operations []*ast.Source
+	// Scalars map custom scalars to Go types, e.g. time.Time or
+	// github.com/foo/bar.Decimal, json.RawMessage if absent
+	Scalars map[string]string
+}
+
+// Generate the Go source of operations
+func Generate(cfg *Config) ([]byte, error) {
+	if cfg.Package == "" {
+		return nil, errors.New("package is required")
+	}
+
+	schema, err := gqlparser.LoadSchema(&ast.Source{Name: "schema", Input: cfg.Schema})
+	if err != nil {
+		return nil, fmt.Errorf("schema: %s", err)
+	}
+
+	doc := &ast.QueryDocument{}
+	for _, src := range cfg.Operations {
+		d, err := parser.ParseQuery(src)
+		if err != nil {
+			return nil, err
+		}
+		doc.Operations = append(doc.Operations, d.Operations...)
+		doc.Fragments = append(doc.Fragments, d.Fragments...)
+	}
+	if errs := validator.ValidateWithRules(schema, doc, nil); len(errs) > 0 {
+		return nil, errs
+	}
+	for _, op := range doc.Operations {
+		if op.Name == "" {
+			return nil, fmt.Errorf("%s:%d: operations must be named", op.Position.Src.Name, op.Position.Line)
+		}
+	}
+
+	g := &generator{
+		schema:  schema,
+		doc:     doc,
+		scalars: cfg.Scalars,
+		imports: map[string]string{
+			"context":                         "",
+			"github.com/pickjunk/brick/utils": "utils",
+		},
+		declared: map[string]bool{},
+	}
+	ops := append(ast.OperationList{}, doc.Operations...)
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].Name < ops[j].Name })
+	for _, op := range ops {
+		if err := g.operation(op); err != nil {
+			return nil, err
+		}
+	}
+
+	var out bytes.Buffer
+	out.WriteString("// Code generated by graphqlgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\n", cfg.Package)
+	// the standard library first, as goimports does
+	var std, others []string
+	for path := range g.imports {
+		if strings.Contains(strings.Split(path, "/")[0], ".") {
+			others = append(others, path)
+		} else {
+			std = append(std, path)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(others)
+	out.WriteString("import (\n")
+	for i, group := range [][]string{std, others} {
+		if i > 0 && len(std) > 0 && len(others) > 0 {
+			out.WriteString("\n")
+		}
+		for _, path := range group {
+			if name := g.imports[path]; name != "" {
+				fmt.Fprintf(&out, "\t%s %q\n", name, path)
+			} else {
+				fmt.Fprintf(&out, "\t%q\n", path)
+			}
+		}
+	}
+	out.WriteString(")\n")
+	out.Write(g.types.Bytes())
+	out.Write(g.funcs.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format: %s\n%s", err, out.Bytes())
+	}
+	return src, nil
+}
+
+type generator struct {
+	schema  *ast.Schema
+	doc     *ast.QueryDocument
+	scalars map[string]string
+	// import paths to names, "" for the default
+	imports map[string]string
+	// enums and input objects declared
+	declared map[string]bool
+	types    bytes.Buffer
+	funcs    bytes.Buffer
+}
+
+func (g *generator) operation(op *ast.OperationDefinition) error {
+	name := goName(op.Name)
+	varsType := name + "Variables"
+	resultType := name + "Result"
+
+	if op.Operation == ast.Subscription {
+		return fmt.Errorf("%s: subscriptions are not supported", op.Name)
+	}
+
+	if len(op.VariableDefinitions) > 0 {
+		// input objects are declared by inputType before the struct
+		var b strings.Builder
+		fmt.Fprintf(&b, "\n// %s of %s\ntype %s struct {\n", varsType, op.Name, varsType)
+		for _, v := range op.VariableDefinitions {
+			tag := v.Variable
+			if optional(v.Type, v.DefaultValue) {
+				tag += ",omitempty"
+			}
+			fmt.Fprintf(&b, "\t%s %s `json:%q`\n", goName(v.Variable), g.inputType(v.Type), tag)
+		}
+		b.WriteString("}\n")
+		g.types.WriteString(b.String())
+	}
+
+	fmt.Fprintf(&g.types, "\n// %s of %s\ntype %s %s\n", resultType, op.Name, resultType, g.selection(op.SelectionSet))
+
+	var query bytes.Buffer
+	formatter.NewFormatter(&query, formatter.WithIndent("  ")).FormatQueryDocument(&ast.QueryDocument{
+		Operations: ast.OperationList{op},
+		Fragments:  g.fragments(op.SelectionSet, ast.FragmentDefinitionList{}),
+	})
+
+	queryName := strings.ToLower(name[:1]) + name[1:] + "Query"
+	fmt.Fprintf(&g.funcs, "\nconst %s = %s\n", queryName, quote(strings.TrimSpace(query.String())))
+
+	fmt.Fprintf(&g.funcs, "\n// %s execute the %s %s by g, whose Query,\n// Variables and Operation are overwritten, data may be partial\n// with errors\n", name, op.Operation, op.Name)
+	if len(op.VariableDefinitions) > 0 {
+		fmt.Fprintf(&g.funcs, "func %s(ctx context.Context, g utils.Graphql, vars *%s) (*%s, error) {\n", name, varsType, resultType)
+	} else {
+		fmt.Fprintf(&g.funcs, "func %s(ctx context.Context, g utils.Graphql) (*%s, error) {\n", name, resultType)
+	}
+	fmt.Fprintf(&g.funcs, "\tg.Query = %s\n\tg.Operation = %q\n", queryName, op.Name)
+	g.funcs.WriteString("\tg.Variables = map[string]interface{}{}\n")
+	for _, v := range op.VariableDefinitions {
+		field := "vars." + goName(v.Variable)
+		if optional(v.Type, v.DefaultValue) {
+			// absent, rather than null, for default values to apply
+			fmt.Fprintf(&g.funcs, "\tif %s != nil {\n\t\tg.Variables[%q] = %s\n\t}\n", field, v.Variable, field)
+		} else {
+			fmt.Fprintf(&g.funcs, "\tg.Variables[%q] = %s\n", v.Variable, field)
+		}
+	}
+	fmt.Fprintf(&g.funcs, "\n\tvar response struct {\n\t\tData *%s `json:\"data\"`\n\t}\n", resultType)
+	g.funcs.WriteString("\terr := g.Fetch(ctx, &response)\n")
+	g.funcs.WriteString("\treturn response.Data, err\n}\n")
+
+	return nil
+}
+
+// fragments used by set, transitively, appended to list
+func (g *generator) fragments(set ast.SelectionSet, list ast.FragmentDefinitionList) ast.FragmentDefinitionList {
+	for _, sel := range set {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			list = g.fragments(sel.SelectionSet, list)
+		case *ast.InlineFragment:
+			list = g.fragments(sel.SelectionSet, list)
+		case *ast.FragmentSpread:
+			if list.ForName(sel.Name) != nil {
+				continue
+			}
+			def := g.doc.Fragments.ForName(sel.Name)
+			list = append(list, def)
+			list = g.fragments(def.SelectionSet, list)
+		}
+	}
+	return list
+}
+
+// selection is the struct of a selection set, fields of fragments are
+// flattened, fields of the same response key are merged
+func (g *generator) selection(set ast.SelectionSet) string {
+	var keys []string
+	fields := map[string][]*ast.Field{}
+	var collect func(set ast.SelectionSet)
+	collect = func(set ast.SelectionSet) {
+		for _, sel := range set {
+			switch sel := sel.(type) {
+			case *ast.Field:
+				key := sel.Alias
+				if key == "" {
+					key = sel.Name
+				}
+				if fields[key] == nil {
+					keys = append(keys, key)
+				}
+				fields[key] = append(fields[key], sel)
+			case *ast.InlineFragment:
+				collect(sel.SelectionSet)
+			case *ast.FragmentSpread:
+				collect(g.doc.Fragments.ForName(sel.Name).SelectionSet)
+			}
+		}
+	}
+	collect(set)
+
+	var b strings.Builder
+	b.WriteString("struct {\n")
+	for _, key := range keys {
+		list := fields[key]
+		var sub ast.SelectionSet
+		for _, f := range list {
+			sub = append(sub, f.SelectionSet...)
+		}
+		t := "string"
+		if list[0].Name != "__typename" {
+			t = g.outputType(list[0].Definition.Type, sub)
+		}
+		fmt.Fprintf(&b, "%s %s `json:%q`\n", goName(key), t, key)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func (g *generator) outputType(t *ast.Type, set ast.SelectionSet) string {
+	if t.Elem != nil {
+		return "[]" + g.outputType(t.Elem, set)
+	}
+
+	var s string
+	def := g.schema.Types[t.NamedType]
+	switch def.Kind {
+	case ast.Object, ast.Interface, ast.Union:
+		s = g.selection(set)
+	default:
+		s = g.namedType(def)
+	}
+	if !t.NonNull {
+		s = "*" + s
+	}
+	return s
+}
+
+func (g *generator) inputType(t *ast.Type) string {
+	if t.Elem != nil {
+		return "[]" + g.inputType(t.Elem)
+	}
+
+	def := g.schema.Types[t.NamedType]
+	s := g.namedType(def)
+	if def.Kind == ast.InputObject && !g.declared[def.Name] {
+		g.declared[def.Name] = true
+		var b strings.Builder
+		fmt.Fprintf(&b, "\n// %s input\ntype %s struct {\n", goName(def.Name), goName(def.Name))
+		for _, f := range def.Fields {
+			tag := f.Name
+			if optional(f.Type, f.DefaultValue) {
+				tag += ",omitempty"
+			}
+			fmt.Fprintf(&b, "\t%s %s `json:%q`\n", goName(f.Name), g.inputType(f.Type), tag)
+		}
+		b.WriteString("}\n")
+		g.types.WriteString(b.String())
+	}
+	if !t.NonNull {
+		s = "*" + s
+	}
+	return s
+}
+
+// namedType of scalars, enums and input objects, enums are declared
+// on the first use
+func (g *generator) namedType(def *ast.Definition) string {
+	switch def.Kind {
+	case ast.Enum:
+		name := goName(def.Name)
+		if !g.declared[def.Name] {
+			g.declared[def.Name] = true
+			fmt.Fprintf(&g.types, "\n// %s enum\ntype %s string\n\n// values of %s\nconst (\n", name, name, name)
+			for _, v := range def.EnumValues {
+				fmt.Fprintf(&g.types, "\t%s%s %s = %q\n", name, goName(strings.ToLower(v.Name)), name, v.Name)
+			}
+			g.types.WriteString(")\n")
+		}
+		return name
+	case ast.InputObject:
+		return goName(def.Name)
+	}
+
+	switch def.Name {
+	case "Int":
+		return "int32"
+	case "Float":
+		return "float64"
+	case "String", "ID":
+		return "string"
+	case "Boolean":
+		return "bool"
+	}
+
+	t, ok := g.scalars[def.Name]
+	if !ok {
+		g.imports["encoding/json"] = ""
+		return "json.RawMessage"
+	}
+	// e.g. github.com/foo/bar.Decimal is imported as bar.Decimal
+	if i := strings.LastIndex(t, "."); i > 0 {
+		path := t[:i]
+		g.imports[path] = ""
+		pkg := path
+		if j := strings.LastIndex(path, "/"); j >= 0 {
+			pkg = path[j+1:]
+		}
+		return pkg + t[i:]
+	}
+	return t
+}
+
+// optional variables and input fields are omitted if nil
+func optional(t *ast.Type, defaultValue *ast.Value) bool {
+	return !t.NonNull || defaultValue != nil
+}
+
+// initialisms kept upper case in Go names
+var initialisms = map[string]bool{
+	"API": true, "HTML": true, "HTTP": true, "ID": true, "IP": true,
+	"JSON": true, "SQL": true, "URL": true, "UUID": true,
+}
+
+// goName of a graphql name, e.g. user_id and userId are UserID
+func goName(name string) string {
+	var words []string
+	start := 0
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case r == '_':
+			if start < i {
+				words = append(words, string(runes[start:i]))
+			}
+			start = i + 1
+		case i > start && unicode.IsUpper(r) && !unicode.IsUpper(runes[i-1]):
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	if start < len(runes) {
+		words = append(words, string(runes[start:]))
+	}
+
+	var b strings.Builder
+	for _, w := range words {
+		if initialisms[strings.ToUpper(w)] {
+			b.WriteString(strings.ToUpper(w))
+			continue
+		}
+		r := []rune(w)
+		b.WriteString(string(unicode.ToUpper(r[0])) + string(r[1:]))
+	}
+	if b.Len() == 0 {
+		return "X"
+	}
+	return b.String()
+}
+
+// quote s as a raw string if possible, for readable queries
+func quote(s string) string {
+	if strings.Contains(s, "`") {
+		return strconv.Quote(s)
+	}
+	return "`" + s + "`"
+}
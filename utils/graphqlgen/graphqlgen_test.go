@@ -0,0 +1,173 @@
+package graphqlgen
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	b "github.com/pickjunk/brick"
+	ast "github.com/vektah/gqlparser/v2/ast"
+)
+
+const testSchema = `
+scalar Time
+
+enum Role {
+	ADMIN
+	SUPER_ADMIN
+}
+
+input UserFilter {
+	role: Role!
+	name: String
+}
+
+interface Node {
+	id: ID!
+}
+
+type User implements Node {
+	id: ID!
+	name: String
+	role: Role!
+	createdAt: Time!
+	friends(first: Int = 10): [User!]!
+}
+
+type Query {
+	user(id: ID!): User
+	users(filter: UserFilter, first: Int): [User]
+	node(id: ID!): Node
+}
+
+type Mutation {
+	rename(id: ID!, name: String!): User!
+}
+`
+
+const testOperations = `
+query GetUser($id: ID!, $first: Int) {
+	user(id: $id) {
+		...UserFields
+		friends(first: $first) { id }
+	}
+	node(id: $id) {
+		__typename
+		... on User { name }
+	}
+}
+
+query ListUsers($filter: UserFilter) {
+	users(filter: $filter) { user_id: id role }
+}
+
+mutation Rename($id: ID!, $name: String!) {
+	rename(id: $id, name: $name) { id name }
+}
+
+fragment UserFields on User {
+	id
+	name
+	createdAt
+}
+`
+
+func TestGenerate(t *testing.T) {
+	src, err := Generate(&Config{
+		Package:    "api",
+		Schema:     testSchema,
+		Operations: []*ast.Source{{Name: "user.graphql", Input: testOperations}},
+		Scalars:    map[string]string{"Time": "time.Time"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expect := range []string{
+		"\t\"time\"\n",
+		"type GetUserVariables struct {\n\tID    string `json:\"id\"`\n\tFirst *int32 `json:\"first,omitempty\"`\n}",
+		"CreatedAt time.Time `json:\"createdAt\"`",
+		// fields of fragments are flattened
+		"Typename string  `json:\"__typename\"`\n\t\tName     *string `json:\"name\"`",
+		"RoleSuperAdmin Role = \"SUPER_ADMIN\"",
+		"type UserFilter struct {\n\tRole Role    `json:\"role\"`\n\tName *string `json:\"name,omitempty\"`\n}",
+		"UserID string `json:\"user_id\"`",
+		"func GetUser(ctx context.Context, g utils.Graphql, vars *GetUserVariables) (*GetUserResult, error) {",
+		"\tif vars.First != nil {\n\t\tg.Variables[\"first\"] = vars.First\n\t}",
+		// fragments used are sent with the operation
+		"}\nfragment UserFields on User {",
+		"func Rename(ctx context.Context, g utils.Graphql, vars *RenameVariables) (*RenameResult, error) {",
+	} {
+		if !strings.Contains(string(src), expect) {
+			t.Errorf("expect %q in:\n%s", expect, src)
+		}
+	}
+	if strings.Contains(listUsersSection(string(src)), "fragment") {
+		t.Errorf("unused fragments should not be sent")
+	}
+
+	// typos are caught
+	_, err = Generate(&Config{
+		Package:    "api",
+		Schema:     testSchema,
+		Operations: []*ast.Source{{Name: "user.graphql", Input: "query GetUser { user(id: 1) { nmae } }"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), `Cannot query field "nmae" on type "User"`) {
+		t.Errorf("can not catch typos: %v", err)
+	}
+
+	_, err = Generate(&Config{
+		Package:    "api",
+		Schema:     testSchema,
+		Operations: []*ast.Source{{Name: "user.graphql", Input: "{ user(id: 1) { id } }"}},
+	})
+	if err == nil || err.Error() != "user.graphql:1: operations must be named" {
+		t.Errorf("can not catch anonymous operations: %v", err)
+	}
+}
+
+func listUsersSection(src string) string {
+	i := strings.Index(src, "const listUsersQuery")
+	j := strings.Index(src, "func ListUsers")
+	return src[i:j]
+}
+
+type introspectionResolver struct{}
+
+func (r *introspectionResolver) Hello(args struct{ Name string }) []*string {
+	return nil
+}
+
+func TestLoadSchema(t *testing.T) {
+	g := b.NewGraphql(&introspectionResolver{})
+	g.Schema(`
+	type Query {
+		hello(name: String = "world"): [String]!
+	}
+	`)
+	r := b.New()
+	r.Graphql("/graphql", g)
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	sdl, err := LoadSchema(context.Background(), s.URL+"/graphql", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sdl, "hello(name: String = \"world\"): [String]!") {
+		t.Errorf("unexpected sdl:\n%s", sdl)
+	}
+
+	src, err := Generate(&Config{
+		Package:    "api",
+		Schema:     sdl,
+		Operations: []*ast.Source{{Name: "hello.graphql", Input: "query Hello($name: String) { hello(name: $name) }"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(src), "Hello []*string `json:\"hello\"`") {
+		t.Errorf("unexpected source:\n%s", src)
+	}
+}
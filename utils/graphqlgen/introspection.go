@@ -0,0 +1,230 @@
+package graphqlgen
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	req "github.com/imroc/req"
+	utils "github.com/pickjunk/brick/utils"
+)
+
+// LoadSchema read the SDL of a .graphql file, or fetch it by
+// introspection if location is a http(s) url
+func LoadSchema(ctx context.Context, location string, headers req.Header) (string, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		data, err := os.ReadFile(location)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+
+	var result struct {
+		Data struct {
+			Schema *introspectionSchema `json:"__schema"`
+		} `json:"data"`
+	}
+	g := utils.Graphql{
+		URL:     location,
+		Query:   introspectionQuery,
+		Headers: headers,
+	}
+	if err := g.Fetch(ctx, &result); err != nil {
+		return "", fmt.Errorf("introspection of %s: %s", location, err)
+	}
+	if result.Data.Schema == nil {
+		return "", fmt.Errorf("introspection of %s: no __schema in the response", location)
+	}
+	return result.Data.Schema.sdl(), nil
+}
+
+const introspectionQuery = `
+query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types {
+      kind
+      name
+      fields(includeDeprecated: true) {
+        name
+        args { name type { ...TypeRef } defaultValue }
+        type { ...TypeRef }
+      }
+      inputFields { name type { ...TypeRef } defaultValue }
+      interfaces { name }
+      enumValues(includeDeprecated: true) { name }
+      possibleTypes { name }
+    }
+  }
+}
+
+fragment TypeRef on __Type {
+  kind
+  name
+  ofType {
+    kind
+    name
+    ofType {
+      kind
+      name
+      ofType {
+        kind
+        name
+        ofType {
+          kind
+          name
+          ofType {
+            kind
+            name
+            ofType { kind name }
+          }
+        }
+      }
+    }
+  }
+}
+`
+
+type introspectionName struct {
+	Name string `json:"name"`
+}
+
+type introspectionTypeRef struct {
+	Kind   string                `json:"kind"`
+	Name   string                `json:"name"`
+	OfType *introspectionTypeRef `json:"ofType"`
+}
+
+func (t *introspectionTypeRef) String() string {
+	switch t.Kind {
+	case "NON_NULL":
+		return t.OfType.String() + "!"
+	case "LIST":
+		return "[" + t.OfType.String() + "]"
+	}
+	return t.Name
+}
+
+type introspectionValue struct {
+	Name         string                `json:"name"`
+	Type         *introspectionTypeRef `json:"type"`
+	DefaultValue *string               `json:"defaultValue"`
+}
+
+func (v *introspectionValue) String() string {
+	s := v.Name + ": " + v.Type.String()
+	if v.DefaultValue != nil {
+		s += " = " + *v.DefaultValue
+	}
+	return s
+}
+
+type introspectionType struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Fields []*struct {
+		Name string                `json:"name"`
+		Args []*introspectionValue `json:"args"`
+		Type *introspectionTypeRef `json:"type"`
+	} `json:"fields"`
+	InputFields   []*introspectionValue `json:"inputFields"`
+	Interfaces    []*introspectionName  `json:"interfaces"`
+	EnumValues    []*introspectionName  `json:"enumValues"`
+	PossibleTypes []*introspectionName  `json:"possibleTypes"`
+}
+
+type introspectionSchema struct {
+	QueryType        *introspectionName   `json:"queryType"`
+	MutationType     *introspectionName   `json:"mutationType"`
+	SubscriptionType *introspectionName   `json:"subscriptionType"`
+	Types            []*introspectionType `json:"types"`
+}
+
+var builtinScalars = map[string]bool{
+	"Int": true, "Float": true, "String": true, "Boolean": true, "ID": true,
+}
+
+// sdl of the schema, directives are left out, which are of no use
+// to clients
+func (s *introspectionSchema) sdl() string {
+	var b strings.Builder
+
+	b.WriteString("schema {\n")
+	for _, root := range []struct {
+		op   string
+		name *introspectionName
+	}{
+		{"query", s.QueryType},
+		{"mutation", s.MutationType},
+		{"subscription", s.SubscriptionType},
+	} {
+		if root.name != nil {
+			fmt.Fprintf(&b, "  %s: %s\n", root.op, root.name.Name)
+		}
+	}
+	b.WriteString("}\n")
+
+	names := func(list []*introspectionName) []string {
+		s := []string{}
+		for _, n := range list {
+			s = append(s, n.Name)
+		}
+		sort.Strings(s)
+		return s
+	}
+
+	for _, t := range s.Types {
+		if strings.HasPrefix(t.Name, "__") || builtinScalars[t.Name] {
+			continue
+		}
+
+		b.WriteString("\n")
+		switch t.Kind {
+		case "SCALAR":
+			fmt.Fprintf(&b, "scalar %s\n", t.Name)
+		case "OBJECT", "INTERFACE":
+			keyword := "type"
+			if t.Kind == "INTERFACE" {
+				keyword = "interface"
+			}
+			fmt.Fprintf(&b, "%s %s", keyword, t.Name)
+			if len(t.Interfaces) > 0 {
+				fmt.Fprintf(&b, " implements %s", strings.Join(names(t.Interfaces), " & "))
+			}
+			b.WriteString(" {\n")
+			for _, f := range t.Fields {
+				fmt.Fprintf(&b, "  %s", f.Name)
+				if len(f.Args) > 0 {
+					args := []string{}
+					for _, arg := range f.Args {
+						args = append(args, arg.String())
+					}
+					fmt.Fprintf(&b, "(%s)", strings.Join(args, ", "))
+				}
+				fmt.Fprintf(&b, ": %s\n", f.Type)
+			}
+			b.WriteString("}\n")
+		case "UNION":
+			fmt.Fprintf(&b, "union %s = %s\n", t.Name, strings.Join(names(t.PossibleTypes), " | "))
+		case "ENUM":
+			fmt.Fprintf(&b, "enum %s {\n", t.Name)
+			for _, v := range t.EnumValues {
+				fmt.Fprintf(&b, "  %s\n", v.Name)
+			}
+			b.WriteString("}\n")
+		case "INPUT_OBJECT":
+			fmt.Fprintf(&b, "input %s {\n", t.Name)
+			for _, f := range t.InputFields {
+				fmt.Fprintf(&b, "  %s\n", f)
+			}
+			b.WriteString("}\n")
+		}
+	}
+
+	return b.String()
+}
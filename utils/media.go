@@ -4,12 +4,13 @@ import (
 	"errors"
 	"strconv"
 	"io"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"context"
 
-	"github.com/imroc/req"
+	b "github.com/pickjunk/brick"
 	uuid "github.com/satori/go.uuid"
 	"github.com/gabriel-vasile/mimetype"
 )
@@ -79,15 +80,25 @@ func DownloadImage(ctx context.Context, url string, scale string, path string) (
 	uuidStr := uuid.Must(uuid.NewV4(), nil).String()
 	tmpFile := path + uuidStr
 
-	ri, err := req.Get(url)
+	r, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return "", err
 	}
-	if ri.Response().StatusCode != 200 {
+	res, err := b.DefaultClient.Do(ctx, "image.download", r)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
 		return "", errors.New("image download error")
 	}
 	defer os.Remove(tmpFile)
-	err = ri.ToFile(tmpFile)
+	tmp, err := os.Create(tmpFile)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(tmp, res.Body)
+	tmp.Close()
 	if err != nil {
 		return "", err
 	}
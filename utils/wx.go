@@ -12,57 +12,149 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
-	"os"
+	"net/http"
+	"net/url"
+	"reflect"
 	"sort"
 	"strings"
 
 	req "github.com/imroc/req"
+	b "github.com/pickjunk/brick"
 	be "github.com/pickjunk/brick/error"
 )
 
 // WxAPI struct
 type WxAPI struct {
-	Method  string
-	URI     string
+	Method string
+	URI    string
+	// Query of scalars, slices (or arrays) are repeated values,
+	// e.g. {"id": []int{1, 2}} is id=1&id=2
 	Query   req.QueryParam
 	Body    map[string]interface{}
 	Headers req.Header
+	// Token is added to Query as access_token (or component_access_token)
+	// if not nil, see WxTokenManager
+	Token *WxTokenSource
 }
 
 var wxURL = "https://api.weixin.qq.com"
 
-// Fetch execute a wx api
+// WxError of a wx api, errmsg which is not a BusinessError
+type WxError struct {
+	Errcode int64
+	Errmsg  string
+}
+
+func (e *WxError) Error() string {
+	return e.Errmsg
+}
+
+// errcodes of an invalid or expired access token
+const (
+	wxInvalidCredential  = 40001
+	wxAccessTokenExpired = 42001
+)
+
+// Fetch execute a wx api by brick.DefaultClient, it is retried once
+// with a refreshed token if the token is rejected (errcode 40001 or 42001)
 func (w *WxAPI) Fetch(ctx context.Context, result interface{}) error {
-	if os.Getenv("ENV") != "production" {
-		req.Debug = true
+	if w.Token == nil {
+		return w.fetch(ctx, result, "")
+	}
+
+	token, err := w.Token.Token(ctx)
+	if err != nil {
+		return err
+	}
+	err = w.fetch(ctx, result, token)
+
+	var wErr *WxError
+	if errors.As(err, &wErr) && (wErr.Errcode == wxInvalidCredential || wErr.Errcode == wxAccessTokenExpired) {
+		log.Warn().Int64("errcode", wErr.Errcode).Str("uri", w.URI).Msg("wx token rejected")
+		token, err = w.Token.token(ctx, token)
+		if err != nil {
+			return err
+		}
+		return w.fetch(ctx, result, token)
+	}
+	return err
+}
+
+// setWxQuery set the value of key, every element if it is a slice
+func setWxQuery(q url.Values, key string, value interface{}) {
+	v := reflect.ValueOf(value)
+	if (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8 {
+		q.Del(key)
+		for i := 0; i < v.Len(); i++ {
+			q.Add(key, fmt.Sprint(v.Index(i).Interface()))
+		}
+		return
+	}
+	if data, ok := value.([]byte); ok {
+		q.Set(key, string(data))
+		return
 	}
-	defer func() {
-		req.Debug = false
-	}()
+	q.Set(key, fmt.Sprint(value))
+}
 
-	var res *req.Resp
-	var err error
-	switch w.Method {
-	case "POST":
-		res, err = req.Post(wxURL+w.URI, w.Headers, w.Query, req.BodyJSON(w.Body), ctx)
-	default:
-		res, err = req.Get(wxURL+w.URI, w.Headers, w.Query, ctx)
+func (w *WxAPI) fetch(ctx context.Context, result interface{}, token string) error {
+	method := w.Method
+	if method != "POST" {
+		method = "GET"
 	}
+
+	var body io.Reader
+	if method == "POST" {
+		data, err := json.Marshal(w.Body)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	r, err := http.NewRequest(method, wxURL+w.URI, body)
+	if err != nil {
+		return err
+	}
+	if method == "POST" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range w.Headers {
+		r.Header.Set(k, v)
+	}
+	if len(w.Query) > 0 || token != "" {
+		q := r.URL.Query()
+		for k, v := range w.Query {
+			setWxQuery(q, k, v)
+		}
+		if token != "" {
+			q.Set(w.Token.param, token)
+		}
+		r.URL.RawQuery = q.Encode()
+	}
+
+	res, err := b.DefaultClient.Do(ctx, "wx.fetch", r)
 	if err != nil {
 		return err
 	}
+	defer res.Body.Close()
 
-	code := res.Response().StatusCode
+	code := res.StatusCode
 	if !(code >= 200 && code < 300) {
 		return fmt.Errorf("http status error: %d", code)
 	}
 
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
 	var e struct {
 		Errcode int64
 		Errmsg  string
 	}
-	err = res.ToJSON(&e)
+	err = json.Unmarshal(data, &e)
 	if err != nil {
 		return err
 	}
@@ -70,13 +162,13 @@ func (w *WxAPI) Fetch(ctx context.Context, result interface{}) error {
 		var bErr be.BusinessError
 		err = json.Unmarshal([]byte(e.Errmsg), &bErr)
 		if err != nil {
-			return errors.New(e.Errmsg)
+			return &WxError{e.Errcode, e.Errmsg}
 		}
 		return &bErr
 	}
 
 	if result != nil {
-		err = res.ToJSON(result)
+		err = json.Unmarshal(data, result)
 		if err != nil {
 			return err
 		}
@@ -148,8 +240,19 @@ func WxEncrypt(data []byte, platformKey, platformAppid string) ([]byte, error) {
 	return cipherData, nil
 }
 
+// errWxDecrypt of data not encrypted by the key
+var errWxDecrypt = errors.New("wx decrypt: invalid data or key")
+
 // WxDecrypt 第三方平台消息解密
 func WxDecrypt(data []byte, platformKey string) ([]byte, error) {
+	plain, _, err := WxDecryptAppid(data, platformKey)
+	return plain, err
+}
+
+// WxDecryptAppid decrypt data like WxDecrypt, and return the appid
+// appended to it, which should be checked against the appid of the
+// platform, or of the official account
+func WxDecryptAppid(data []byte, platformKey string) ([]byte, string, error) {
 	// base64 decode 密钥
 	key := platformKey + "="
 	ekey, _ := base64.StdEncoding.DecodeString(key)
@@ -157,21 +260,33 @@ func WxDecrypt(data []byte, platformKey string) ([]byte, error) {
 	// AES CBC 解密
 	block, err := aes.NewCipher(ekey)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	// ekey[:16] 这里为iv，类似于session key
 	// 这里很可能是微信算法不规范
 	// 一般来说iv应该是随机且要放在加密体里
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, "", errWxDecrypt
+	}
 	cbc := cipher.NewCBCDecrypter(block, ekey[:16])
 	target := make([]byte, len(data))
 	cbc.CryptBlocks(target, data)
 
 	// 解密后，取消补位
+	if pad := int(target[len(target)-1]); pad == 0 || pad > 32 || pad > len(target) {
+		return nil, "", errWxDecrypt
+	}
 	target = pkcs7Unpad(target, 32)
 
 	// 提取data
+	if len(target) < 20 {
+		return nil, "", errWxDecrypt
+	}
 	dataLen := binary.BigEndian.Uint32(target[16:20])
-	return target[20 : 20+dataLen], nil
+	if uint64(dataLen) > uint64(len(target)-20) {
+		return nil, "", errWxDecrypt
+	}
+	return target[20 : 20+dataLen], string(target[20+dataLen:]), nil
 }
 
 // WxSign 第三方平台签名
@@ -1,7 +1,11 @@
 package utils
 
 import (
+	"context"
 	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -26,6 +30,14 @@ func TestWxEncryptAndWxDecrypt(t *testing.T) {
 	}
 
 	log.Info().Msg(string(decrypt))
+
+	// errors instead of panics
+	if _, err := WxDecrypt(encrypt, "abcdefghijklmnopqrstuvwxyz0123456789ABCDEFG"); err == nil {
+		t.Errorf("expect an error of a wrong key")
+	}
+	if _, err := WxDecrypt(encrypt[:len(encrypt)-1], key); err == nil {
+		t.Errorf("expect an error of truncated data")
+	}
 }
 
 func TestWxDecryptUserInfo(t *testing.T) {
@@ -61,3 +73,33 @@ func TestWxDecryptUserInfo(t *testing.T) {
 
 	log.Info().Msg(string(decrypt))
 }
+
+func TestWxAPIQuery(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"query": r.URL.RawQuery})
+	}))
+	defer s.Close()
+
+	origin := wxURL
+	wxURL = s.URL
+	defer func() { wxURL = origin }()
+
+	var result struct {
+		Query string
+	}
+	api := WxAPI{
+		URI: "/query",
+		Query: map[string]interface{}{
+			"id":   []int{1, 2},
+			"name": "a b",
+			"n":    3,
+		},
+	}
+	if err := api.Fetch(context.Background(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Query != "id=1&id=2&n=3&name=a+b" {
+		t.Errorf("expect id=1&id=2&n=3&name=a+b, but get %s", result.Query)
+	}
+}
+
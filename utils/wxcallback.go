@@ -0,0 +1,409 @@
+package utils
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	b "github.com/pickjunk/brick"
+)
+
+// WxInfo pushed by wx to the authorization event url of a third-party
+// platform, by InfoType:
+//
+//	component_verify_ticket  ComponentVerifyTicket, every 10 minutes
+//	authorized               AuthorizerAppid, AuthorizationCode, ...
+//	updateauthorized         AuthorizerAppid, AuthorizationCode, ...
+//	unauthorized             AuthorizerAppid
+type WxInfo struct {
+	AppID                        string `xml:"AppId"`
+	CreateTime                   int64
+	InfoType                     string
+	ComponentVerifyTicket        string
+	AuthorizerAppid              string
+	AuthorizationCode            string
+	AuthorizationCodeExpiredTime int64
+	PreAuthCode                  string
+}
+
+// WxMessage of users, or events, pushed by wx to the message and event
+// url of a third-party platform, fields are set by MsgType and Event
+type WxMessage struct {
+	ToUserName   string
+	FromUserName string
+	CreateTime   int64
+	MsgType      string
+	MsgID        int64 `xml:"MsgId"`
+
+	// text
+	Content string
+	// image, voice, video and shortvideo
+	MediaID      string `xml:"MediaId"`
+	PicURL       string `xml:"PicUrl"`
+	Format       string
+	Recognition  string
+	ThumbMediaID string `xml:"ThumbMediaId"`
+	// location
+	LocationX float64 `xml:"Location_X"`
+	LocationY float64 `xml:"Location_Y"`
+	Scale     int
+	Label     string
+	// link
+	Title       string
+	Description string
+	URL         string `xml:"Url"`
+
+	// event
+	Event     string
+	EventKey  string
+	Ticket    string
+	Latitude  float64
+	Longitude float64
+	Precision float64
+}
+
+// WxArticle of a news reply
+type WxArticle struct {
+	Title       string
+	Description string
+	PicURL      string
+	URL         string
+}
+
+// WxReply to a WxMessage, by MsgType:
+//
+//	text   Content
+//	image  MediaID
+//	voice  MediaID
+//	video  MediaID, Title, Description
+//	news   Articles
+type WxReply struct {
+	MsgType     string
+	Content     string
+	MediaID     string
+	Title       string
+	Description string
+	Articles    []WxArticle
+}
+
+// WxInfoHandler handle a WxInfo, wx pushes it again on errors
+type WxInfoHandler = func(ctx context.Context, info *WxInfo) error
+
+// WxMessageHandler handle a WxMessage, a nil WxReply replies nothing
+type WxMessageHandler = func(ctx context.Context, m *WxMessage) (*WxReply, error)
+
+// WxCallback is the callback of a third-party platform, for both the
+// authorization event url and the message and event url. It verifies
+// msg_signature, decrypts the envelope, dispatches infos and messages to
+// handlers, and encrypts replies
+type WxCallback struct {
+	// Appid of the platform
+	Appid string
+	// Token of messages, for signatures
+	Token string
+	// Key of messages (EncodingAESKey)
+	Key string
+	// Tokens saves component_verify_ticket if not nil, and tokens of
+	// authorizers on authorization if Secret is set too
+	Tokens *WxTokenManager
+	// Secret of the platform
+	Secret string
+	// MaxAge of the timestamp of pushes, which are rejected with 403 if
+	// it is older, or newer, against replays, 5 minutes if zero,
+	// -1 to disable it
+	MaxAge time.Duration
+
+	infos    map[string]WxInfoHandler
+	messages map[string]WxMessageHandler
+	events   map[string]WxMessageHandler
+}
+
+// NewWxCallback create a WxCallback of a platform
+func NewWxCallback(appid, token, key string) *WxCallback {
+	if len(key) != 43 {
+		log.Panic().Msgf("expect an EncodingAESKey of 43 characters, but get %d", len(key))
+	}
+
+	return &WxCallback{
+		Appid:    appid,
+		Token:    token,
+		Key:      key,
+		infos:    make(map[string]WxInfoHandler),
+		messages: make(map[string]WxMessageHandler),
+		events:   make(map[string]WxMessageHandler),
+	}
+}
+
+// OnInfo register the handler of an InfoType, e.g. authorized
+func (c *WxCallback) OnInfo(infoType string, h WxInfoHandler) *WxCallback {
+	c.infos[infoType] = h
+	return c
+}
+
+// OnMessage register the handler of a MsgType, e.g. text
+func (c *WxCallback) OnMessage(msgType string, h WxMessageHandler) *WxCallback {
+	c.messages[msgType] = h
+	return c
+}
+
+// OnEvent register the handler of an Event of MsgType event,
+// e.g. subscribe or CLICK, events of no handler are passed to
+// the handler of MsgType event if any
+func (c *WxCallback) OnEvent(event string, h WxMessageHandler) *WxCallback {
+	c.events[event] = h
+	return c
+}
+
+// wxEnvelope of encrypted infos and messages
+type wxEnvelope struct {
+	AppID      string `xml:"AppId"`
+	ToUserName string
+	Encrypt    string
+}
+
+type cdata struct {
+	Value string `xml:",cdata"`
+}
+
+type wxReplyXML struct {
+	XMLName      xml.Name `xml:"xml"`
+	ToUserName   cdata
+	FromUserName cdata
+	CreateTime   int64
+	MsgType      cdata
+	Content      *cdata `xml:",omitempty"`
+	Image        *wxReplyMedia
+	Voice        *wxReplyMedia
+	Video        *wxReplyMedia
+	ArticleCount int `xml:",omitempty"`
+	Articles     *struct {
+		Items []wxReplyArticle `xml:"item"`
+	}
+}
+
+type wxReplyMedia struct {
+	MediaID     cdata  `xml:"MediaId"`
+	Title       *cdata `xml:",omitempty"`
+	Description *cdata `xml:",omitempty"`
+}
+
+type wxReplyArticle struct {
+	Title       cdata
+	Description cdata
+	PicURL      cdata `xml:"PicUrl"`
+	URL         cdata `xml:"Url"`
+}
+
+type wxEncryptedReply struct {
+	XMLName      xml.Name `xml:"xml"`
+	Encrypt      cdata
+	MsgSignature cdata
+	TimeStamp    string
+	Nonce        cdata
+}
+
+// Handle is a brick.Handle of the callback, e.g.
+// r.POST("/wx/callback", c.Handle)
+func (c *WxCallback) Handle(ctx context.Context) {
+	r := b.Request(ctx)
+	w := b.Response(ctx)
+
+	query := r.URL.Query()
+	timestamp := query.Get("timestamp")
+	nonce := query.Get("nonce")
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	var envelope wxEnvelope
+	if err := xml.Unmarshal(data, &envelope); err != nil || envelope.Encrypt == "" {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	signature := WxSign(timestamp, nonce, envelope.Encrypt, c.Token)
+	if subtle.ConstantTimeCompare([]byte(signature), []byte(query.Get("msg_signature"))) != 1 {
+		log.Warn().Str("url", r.URL.Path).Msg("wx callback signature mismatch")
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if !c.fresh(timestamp) {
+		log.Warn().Str("url", r.URL.Path).Str("timestamp", timestamp).Msg("wx callback timestamp stale")
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	encrypted, err := base64.StdEncoding.DecodeString(envelope.Encrypt)
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	plain, appid, err := WxDecryptAppid(encrypted, c.Key)
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(appid), []byte(c.Appid)) != 1 {
+		log.Warn().Str("url", r.URL.Path).Str("appid", appid).Msg("wx callback appid mismatch")
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	// either a WxInfo or a WxMessage
+	var info WxInfo
+	if err := xml.Unmarshal(plain, &info); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if info.InfoType != "" {
+		if err := c.info(ctx, &info); err != nil {
+			log.Error().Err(err).Str("infoType", info.InfoType).Msg("wx callback")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("success"))
+		return
+	}
+
+	m := &WxMessage{}
+	if err := xml.Unmarshal(plain, m); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	reply, err := c.message(ctx, m)
+	if err != nil {
+		log.Error().Err(err).Str("msgType", m.MsgType).Str("event", m.Event).Msg("wx callback")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if reply == nil {
+		w.Write([]byte("success"))
+		return
+	}
+
+	out, err := c.encrypt(m, reply)
+	if err != nil {
+		log.Error().Err(err).Msg("wx callback reply")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write(out)
+}
+
+// fresh return true if timestamp is within MaxAge of now
+func (c *WxCallback) fresh(timestamp string) bool {
+	maxAge := c.MaxAge
+	if maxAge < 0 {
+		return true
+	}
+	if maxAge == 0 {
+		maxAge = 5 * time.Minute
+	}
+
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := time.Since(time.Unix(t, 0))
+	return age <= maxAge && age >= -maxAge
+}
+
+func (c *WxCallback) info(ctx context.Context, info *WxInfo) error {
+	if c.Tokens != nil {
+		switch info.InfoType {
+		case "component_verify_ticket":
+			err := c.Tokens.SetComponentVerifyTicket(ctx, c.Appid, info.ComponentVerifyTicket)
+			if err != nil {
+				return err
+			}
+		case "authorized", "updateauthorized":
+			if c.Secret != "" {
+				_, err := c.Tokens.QueryAuth(ctx, c.Appid, c.Secret, info.AuthorizationCode)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if h, ok := c.infos[info.InfoType]; ok {
+		return h(ctx, info)
+	}
+	return nil
+}
+
+func (c *WxCallback) message(ctx context.Context, m *WxMessage) (*WxReply, error) {
+	if m.MsgType == "event" {
+		if h, ok := c.events[m.Event]; ok {
+			return h(ctx, m)
+		}
+	}
+	if h, ok := c.messages[m.MsgType]; ok {
+		return h(ctx, m)
+	}
+	return nil, nil
+}
+
+// encrypt the reply to m, from whom it was sent to
+func (c *WxCallback) encrypt(m *WxMessage, reply *WxReply) ([]byte, error) {
+	x := wxReplyXML{
+		ToUserName:   cdata{m.FromUserName},
+		FromUserName: cdata{m.ToUserName},
+		CreateTime:   time.Now().Unix(),
+		MsgType:      cdata{reply.MsgType},
+	}
+	switch reply.MsgType {
+	case "text":
+		x.Content = &cdata{reply.Content}
+	case "image":
+		x.Image = &wxReplyMedia{MediaID: cdata{reply.MediaID}}
+	case "voice":
+		x.Voice = &wxReplyMedia{MediaID: cdata{reply.MediaID}}
+	case "video":
+		x.Video = &wxReplyMedia{
+			MediaID:     cdata{reply.MediaID},
+			Title:       &cdata{reply.Title},
+			Description: &cdata{reply.Description},
+		}
+	case "news":
+		x.ArticleCount = len(reply.Articles)
+		x.Articles = &struct {
+			Items []wxReplyArticle `xml:"item"`
+		}{}
+		for _, a := range reply.Articles {
+			x.Articles.Items = append(x.Articles.Items, wxReplyArticle{
+				Title:       cdata{a.Title},
+				Description: cdata{a.Description},
+				PicURL:      cdata{a.PicURL},
+				URL:         cdata{a.URL},
+			})
+		}
+	}
+	data, err := xml.Marshal(x)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := WxEncrypt(data, c.Key, c.Appid)
+	if err != nil {
+		return nil, err
+	}
+	encrypt := base64.StdEncoding.EncodeToString(encrypted)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := string(randStr(16))
+
+	return xml.Marshal(wxEncryptedReply{
+		Encrypt:      cdata{encrypt},
+		MsgSignature: cdata{WxSign(timestamp, nonce, encrypt, c.Token)},
+		TimeStamp:    timestamp,
+		Nonce:        cdata{nonce},
+	})
+}
@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	b "github.com/pickjunk/brick"
+)
+
+// samples recorded of a platform of token pamtest and the key below, the
+// envelope of infos has AppId instead of ToUserName
+var wxCallbackSamples = []struct {
+	signature string
+	encrypt   string
+}{
+	// ticket
+	{
+		"f91f174b9f9cff126886f8873f7e25e223d7b191",
+		"OV+pWztFyxS+DsbdjwwfrzdVm7BM1dXgLVPCFRtT+M2DmkBVJoomhodEeorwy3FpxaEa/1CSpMYCVOfiEVtCVFvnFsqkykYpdwXKpbbOLelgHlGmyeHXHgZD3Uh8OK8s7FlUyvrC1rjtraGWI3naWgpHRveDdzsEJZGwwZpbt52gQJELNMJOfXkADFGhTvGMa7pOG1d0l6jo1I4Bl7cJgu+0lABmwMTS+Lr9y/KvXW8iW2FMysKLNaOj837CRhe0mLb0Qf2mWWiM04Gj7h/q53PP2kCe0DfB9ooxbIfhVEMf6dtyifI5M2ddVZvihUFHqgH5NspVc0xnrTLDIouRYbtHWZFQMhAxC66rRl0HnWwkpXaoBw5Gf0f3oFi/TNCSIcEC29kEYXk2CgafVv9oy3zZlObgmoF/g6oyfOUrLWXaJblJblg9vBxakavRXhT5Q7qrir2UoZFH/qEruoU3mQ==",
+	},
+	// authorized
+	{
+		"79d01efc963c23c4060a74375189d10d4bee3902",
+		"yGp7EvgQevab2OxByVW42rfYpmt3SOPr0o52BW5UPpeU0veU4iYtH/ll3fxzM+bpxhFY/vabnaIc37vxBOx5q0/BzrVMlNwUxY89h/kvftDX0lswygJJmufILKjnJAyPom0gKmafVUa2PWH/v104JbYYov4Id72oND7S0Q85VYXqKPhPJxEdImL8BsneNjkpR6ITeAwaTlI0zRrPDutaUIj1cnPZ1KP4J+UNCWBdwkdljqd6w9V0y8l+MAzTZSWnGcEJY7/dZUBIqDzKWPAObvN4bKxL3I/yVZI5P02S8HmZYEGVhd878gNpcx5K+RD72eHTL/q54PvtoMZujtjhkhC9YEBRAB7zz7oR3lpusc7bETtbj1KeokQSF1BoCJaLizpH/U168PNMnOSAP1t3xD9thQQ2i1vteU70wfrnt1jj/vDcCECT7+L6OmSmYTKUjqOfr2VmWNTEYkvnoUg1NxAJJV7lBjpxDUnyO0c/5doZPp37cOqFU8313xx8IAoBY4x7iSAghOkp2ECAmI1MJ+kwiQhxMfEkZGaTl71VnMnZEJm9Y2mkWG6yLbQLxGsVzuIVAvAoJOg/UxzZFO+5e0Jgft0kmeYANqJEerkuPrdTNfEYUBXk5VKDPlq+JcZDxS1mDYHy1y3+gJWb8FWkjlRMI+HWueWrM8wJkmASxQ4=",
+	},
+	// text
+	{
+		"c72b1c7360eb40e5d48ce13a849a538198636462",
+		"CMhLMAoUAiDYtph5SdLCP2qDW0Dd8z1MV24JTuCisrS3i3nEZXDsmWxPBDUdKpwnCort0Zo2GA/ivA9sV9+bbRIE0boThqCl6Bw7rLC8NmEdxhs8GfipS8us/ATZJh3jdRskbJy4/WB4ifiI4G6joCj3Yw3ih3R+bnhOqjQuV5XnFhPy88d4p9J5a3N/mHcf6mKRXXTndspouktbMOmiTHU93NFB8PIxgmp7/xOdzD6EvQwdf6AT8FmEkduWmkVGZRKybUQkLzProD/Oe3RC3uhvvmmf6QWGhvGLoZQLA0Vxtu1BMs5Oe22/LfP7SvuOe+ee4sbecl01rixY2ffgivXAEzXWoEwJgrxlB8bu8MmszFfYyCuDiRiF9183BbaF10mhl+0J/subpdNG9DX1usUgBVxnAHFkBByn2pLRviku/nu2WA0Cd2wHIgSmS2SMUZZQvxN7sVX9HWumJ2y9Dg==",
+	},
+	// subscribe
+	{
+		"05fe367d980f1bf7c884096993ffebedd331dbec",
+		"mzjqVmmpIMCI/Js64s7MU8I5SQi5wlTfqTwaRrBau88F+kio0wbk+viIG6ffvjzmrhJmmrk4dc6epeIev+JwTgXb1UDbw92BL2FKLQh1iihZIhLKX6WABMm8epvOkIRsQyC0eUBFcdWk/bqtJ5Cxty4vmQTHRWFlryxMqa5fvpvBOt9ZvQAnOFrQAV9PL70iXRTdy0IURixuk3QQxPKqyeTgFiLKQldUn5LT3PJ2YGxhN/aW8hZbtgEBJlOPXcpzJPdujfT9J1DobLusGOoNkZmdmE7jVy8sLfrjO4TW14kvLXHNGBE+isP6Vm2ZacQ6bzy/DxNzi+OS0couiJ7tftv5oAyvWzkfwoa4U/zkrqfVY76xQF0FyFLPotH2yhJf7vvyZK+T/cZA0T8chESwtHdK66+EJl9n/ptJ0UsscUy0iofUbnsPX8vdkQVzAZkV2KmGd+2fd1obRTURZeyOAIBW6bdpRQAbQGiCbmb46NApzbgQN91KvdOHRnP8fKO7",
+	},
+}
+
+const wxCallbackKey = "abcdefghijklmnopqrstuvwxyz0123456789ABCDEFG"
+
+// wxCallbackRequest send the sample i, at the recorded timestamp and by the
+// recorded signature if they are empty
+func wxCallbackRequest(r *b.Router, i int, timestamp, signature string) *httptest.ResponseRecorder {
+	sample := wxCallbackSamples[i]
+	if timestamp == "" {
+		timestamp = "1413192605"
+	}
+	if signature == "" {
+		signature = sample.signature
+	}
+	body := "<xml><ToUserName><![CDATA[gh_3c884a361561]]></ToUserName><Encrypt><![CDATA[" + sample.encrypt + "]]></Encrypt></xml>"
+	req := httptest.NewRequest("POST", "/wx/callback?timestamp="+timestamp+"&nonce=1320562132&encrypt_type=aes&msg_signature="+signature, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestWxCallback(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+
+		switch r.URL.Path {
+		case "/cgi-bin/component/api_component_token":
+			if !strings.HasPrefix(body["component_verify_ticket"], "ticket@@@") {
+				w.Write([]byte(`{"errcode":61006,"errmsg":"component ticket is invalid"}`))
+				return
+			}
+			w.Write([]byte(`{"component_access_token":"component","expires_in":7200}`))
+		case "/cgi-bin/component/api_query_auth":
+			if r.URL.Query().Get("component_access_token") != "component" || !strings.HasPrefix(body["authorization_code"], "queryauthcode@@@") {
+				w.Write([]byte(`{"errcode":40001,"errmsg":"invalid credential"}`))
+				return
+			}
+			w.Write([]byte(`{"authorization_info":{"authorizer_appid":"wxf8b4f85f3a794e77","authorizer_access_token":"authorizer","expires_in":7200,"authorizer_refresh_token":"refresh"}}`))
+		}
+	}))
+	defer s.Close()
+
+	origin := wxURL
+	wxURL = s.URL
+	defer func() { wxURL = origin }()
+
+	ctx := context.Background()
+	tokens := NewWxTokenManager(nil)
+	c := NewWxCallback("wx304925fbea25bcbe", "pamtest", wxCallbackKey)
+	c.Tokens = tokens
+	c.Secret = "secret"
+	// of the samples recorded
+	c.MaxAge = -1
+
+	var authorized *WxInfo
+	c.OnInfo("authorized", func(ctx context.Context, info *WxInfo) error {
+		authorized = info
+		return nil
+	}).OnMessage("text", func(ctx context.Context, m *WxMessage) (*WxReply, error) {
+		return &WxReply{MsgType: "text", Content: m.Content + "_callback"}, nil
+	}).OnEvent("subscribe", func(ctx context.Context, m *WxMessage) (*WxReply, error) {
+		if m.EventKey != "qrscene_123123" {
+			return nil, errors.New("unexpected EventKey " + m.EventKey)
+		}
+		return nil, nil
+	})
+
+	r := b.New()
+	r.POST("/wx/callback", c.Handle)
+
+	// signatures are verified
+	if w := wxCallbackRequest(r, 0, "", "0000000000000000000000000000000000000000"); w.Code != http.StatusForbidden {
+		t.Errorf("expect 403 of a wrong signature, but get %d", w.Code)
+	}
+
+	// component_verify_ticket is saved
+	if w := wxCallbackRequest(r, 0, "", ""); w.Code != http.StatusOK || w.Body.String() != "success" {
+		t.Errorf("expect success, but get %d %s", w.Code, w.Body)
+	}
+	ticket, _ := tokens.Store.Get(ctx, "component_verify_ticket:wx304925fbea25bcbe")
+	if ticket == nil || !strings.HasPrefix(ticket.Token, "ticket@@@lEHjsBEi") {
+		t.Errorf("component_verify_ticket not saved: %v", ticket)
+	}
+
+	// tokens of authorizers are saved on authorization
+	if w := wxCallbackRequest(r, 1, "", ""); w.Code != http.StatusOK || w.Body.String() != "success" {
+		t.Errorf("expect success, but get %d %s", w.Code, w.Body)
+	}
+	if authorized == nil || authorized.AuthorizerAppid != "wxf8b4f85f3a794e77" || authorized.AuthorizationCodeExpiredTime != 1413196360 {
+		t.Errorf("authorized not handled: %+v", authorized)
+	}
+	token, err := tokens.AuthorizerAccessToken("wx304925fbea25bcbe", "secret", "wxf8b4f85f3a794e77").Token(ctx)
+	if err != nil || token != "authorizer" {
+		t.Errorf("expect the token of the authorizer, but get %s, %v", token, err)
+	}
+
+	// replies are encrypted
+	w := wxCallbackRequest(r, 2, "", "")
+	var reply wxEncryptedReply
+	if err := xml.Unmarshal(w.Body.Bytes(), &reply); err != nil {
+		t.Fatalf("can not parse the reply: %v, %s", err, w.Body)
+	}
+	if WxSign(reply.TimeStamp, reply.Nonce.Value, reply.Encrypt.Value, "pamtest") != reply.MsgSignature.Value {
+		t.Errorf("wrong signature of the reply")
+	}
+	encrypted, _ := base64.StdEncoding.DecodeString(reply.Encrypt.Value)
+	plain, err := WxDecrypt(encrypted, wxCallbackKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m WxMessage
+	xml.Unmarshal(plain, &m)
+	if m.ToUserName != "ozy4qt5QUADNXORxCVipKMV9dss0" || m.FromUserName != "gh_3c884a361561" || m.MsgType != "text" || m.Content != "TESTCOMPONENT_MSG_TYPE_TEXT_callback" {
+		t.Errorf("unexpected reply: %s", plain)
+	}
+
+	// events, without replies
+	if w := wxCallbackRequest(r, 3, "", ""); w.Code != http.StatusOK || w.Body.String() != "success" {
+		t.Errorf("expect success, but get %d %s", w.Code, w.Body)
+	}
+
+	// errors of handlers
+	c.OnEvent("subscribe", func(ctx context.Context, m *WxMessage) (*WxReply, error) {
+		return nil, errors.New("oops")
+	})
+	if w := wxCallbackRequest(r, 3, "", ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("expect 500, but get %d", w.Code)
+	}
+}
+
+func TestWxCallbackReplay(t *testing.T) {
+	c := NewWxCallback("wx304925fbea25bcbe", "pamtest", wxCallbackKey)
+	r := b.New()
+	r.POST("/wx/callback", c.Handle)
+
+	// stale timestamps
+	if w := wxCallbackRequest(r, 0, "", ""); w.Code != http.StatusForbidden {
+		t.Errorf("expect 403 of a stale timestamp, but get %d", w.Code)
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := WxSign(now, "1320562132", wxCallbackSamples[0].encrypt, "pamtest")
+	if w := wxCallbackRequest(r, 0, now, signature); w.Code != http.StatusOK || w.Body.String() != "success" {
+		t.Errorf("expect success, but get %d %s", w.Code, w.Body)
+	}
+
+	// pushes to other platforms of the same token and key
+	other := NewWxCallback("wx0000000000000000", "pamtest", wxCallbackKey)
+	r = b.New()
+	r.POST("/wx/callback", other.Handle)
+	if w := wxCallbackRequest(r, 0, now, signature); w.Code != http.StatusForbidden {
+		t.Errorf("expect 403 of another appid, but get %d", w.Code)
+	}
+}
@@ -0,0 +1,365 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// WxToken of a WxTokenStore, a zero ExpiresAt never expires
+type WxToken struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+// WxTokenStore store tokens of wx by key, share a store between
+// replicas to reuse tokens refreshed by each other. Refreshes are only
+// serialized within a process, replicas may still refresh the same
+// token at the same time, and a rotated authorizer refresh token may be
+// overwritten by a stale one, so refresh from a single replica if that
+// matters
+type WxTokenStore interface {
+	// Get return nil if the key is not found
+	Get(ctx context.Context, key string) (*WxToken, error)
+	Set(ctx context.Context, key string, token *WxToken) error
+}
+
+// memoryWxTokenStore in-memory WxTokenStore
+type memoryWxTokenStore struct {
+	sync.Mutex
+	tokens map[string]WxToken
+}
+
+// NewMemoryWxTokenStore create an in-memory WxTokenStore
+func NewMemoryWxTokenStore() WxTokenStore {
+	return &memoryWxTokenStore{tokens: make(map[string]WxToken)}
+}
+
+func (s *memoryWxTokenStore) Get(ctx context.Context, key string) (*WxToken, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	t, ok := s.tokens[key]
+	if !ok {
+		return nil, nil
+	}
+	return &t, nil
+}
+
+func (s *memoryWxTokenStore) Set(ctx context.Context, key string, token *WxToken) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.tokens[key] = *token
+	return nil
+}
+
+// WxTokenManager obtain, cache and refresh access tokens of official
+// accounts, mini programs and third-party platforms. Tokens are cached in
+// memory, in front of the Store, and refreshed RefreshBefore they expire
+type WxTokenManager struct {
+	// Store of tokens, tickets and refresh tokens
+	Store WxTokenStore
+	// RefreshBefore tokens expire, 5 minutes by default, during which
+	// the old token is still accepted by wx
+	RefreshBefore time.Duration
+
+	mu    sync.Mutex
+	cache map[string]WxToken
+	locks map[string]*sync.Mutex
+}
+
+// NewWxTokenManager create a WxTokenManager on store, an in-memory
+// store if nil
+func NewWxTokenManager(store WxTokenStore) *WxTokenManager {
+	if store == nil {
+		store = NewMemoryWxTokenStore()
+	}
+	return &WxTokenManager{
+		Store:         store,
+		RefreshBefore: 5 * time.Minute,
+		cache:         make(map[string]WxToken),
+		locks:         make(map[string]*sync.Mutex),
+	}
+}
+
+// WxTokenSource of a kind of token, for WxAPI.Token
+type WxTokenSource struct {
+	m   *WxTokenManager
+	key string
+	// param of the token in the query of apis
+	param string
+	// refresh obtain a new token from wx
+	refresh func(ctx context.Context) (*WxToken, error)
+}
+
+// ErrWxTicketNotFound is returned by component tokens before
+// a component_verify_ticket is pushed by wx
+var ErrWxTicketNotFound = errors.New("component_verify_ticket not found")
+
+// ErrWxRefreshTokenNotFound is returned by authorizer tokens before
+// the authorizer_refresh_token of the authorizer is set
+var ErrWxRefreshTokenNotFound = errors.New("authorizer_refresh_token not found")
+
+// ErrWxAuthorizationInvalid is returned by QueryAuth if the
+// authorizer_appid or authorizer_refresh_token of the authorization
+// is empty
+var ErrWxAuthorizationInvalid = errors.New("authorizer_appid or authorizer_refresh_token is empty")
+
+type wxTokenResult struct {
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+func (r wxTokenResult) expiresAt() time.Time {
+	return time.Now().Add(time.Duration(r.ExpiresIn) * time.Second)
+}
+
+// AccessToken of an official account or a mini program, by the
+// client_credential grant
+func (m *WxTokenManager) AccessToken(appid, secret string) *WxTokenSource {
+	return &WxTokenSource{
+		m:     m,
+		key:   "access_token:" + appid,
+		param: "access_token",
+		refresh: func(ctx context.Context) (*WxToken, error) {
+			var result struct {
+				wxTokenResult
+				AccessToken string `json:"access_token"`
+			}
+			api := WxAPI{
+				URI: "/cgi-bin/token",
+				Query: map[string]interface{}{
+					"grant_type": "client_credential",
+					"appid":      appid,
+					"secret":     secret,
+				},
+			}
+			if err := api.Fetch(ctx, &result); err != nil {
+				return nil, err
+			}
+			return &WxToken{result.AccessToken, result.expiresAt()}, nil
+		},
+	}
+}
+
+// ComponentAccessToken of a third-party platform, by the latest
+// component_verify_ticket, see SetComponentVerifyTicket
+func (m *WxTokenManager) ComponentAccessToken(componentAppid, componentSecret string) *WxTokenSource {
+	return &WxTokenSource{
+		m:     m,
+		key:   "component_access_token:" + componentAppid,
+		param: "component_access_token",
+		refresh: func(ctx context.Context) (*WxToken, error) {
+			ticket, err := m.Store.Get(ctx, "component_verify_ticket:"+componentAppid)
+			if err != nil {
+				return nil, err
+			}
+			if ticket == nil {
+				return nil, ErrWxTicketNotFound
+			}
+
+			var result struct {
+				wxTokenResult
+				ComponentAccessToken string `json:"component_access_token"`
+			}
+			api := WxAPI{
+				Method: "POST",
+				URI:    "/cgi-bin/component/api_component_token",
+				Body: map[string]interface{}{
+					"component_appid":         componentAppid,
+					"component_appsecret":     componentSecret,
+					"component_verify_ticket": ticket.Token,
+				},
+			}
+			if err := api.Fetch(ctx, &result); err != nil {
+				return nil, err
+			}
+			return &WxToken{result.ComponentAccessToken, result.expiresAt()}, nil
+		},
+	}
+}
+
+// AuthorizerAccessToken of an official account or a mini program
+// authorized to a third-party platform, by its authorizer_refresh_token,
+// see SetAuthorizerRefreshToken
+func (m *WxTokenManager) AuthorizerAccessToken(componentAppid, componentSecret, authorizerAppid string) *WxTokenSource {
+	refreshKey := "authorizer_refresh_token:" + componentAppid + ":" + authorizerAppid
+	return &WxTokenSource{
+		m:     m,
+		key:   "authorizer_access_token:" + componentAppid + ":" + authorizerAppid,
+		param: "access_token",
+		refresh: func(ctx context.Context) (*WxToken, error) {
+			refreshToken, err := m.Store.Get(ctx, refreshKey)
+			if err != nil {
+				return nil, err
+			}
+			if refreshToken == nil {
+				return nil, ErrWxRefreshTokenNotFound
+			}
+
+			var result struct {
+				wxTokenResult
+				AuthorizerAccessToken  string `json:"authorizer_access_token"`
+				AuthorizerRefreshToken string `json:"authorizer_refresh_token"`
+			}
+			api := WxAPI{
+				Method: "POST",
+				URI:    "/cgi-bin/component/api_authorizer_token",
+				Body: map[string]interface{}{
+					"component_appid":          componentAppid,
+					"authorizer_appid":         authorizerAppid,
+					"authorizer_refresh_token": refreshToken.Token,
+				},
+				Token: m.ComponentAccessToken(componentAppid, componentSecret),
+			}
+			if err := api.Fetch(ctx, &result); err != nil {
+				return nil, err
+			}
+
+			if result.AuthorizerRefreshToken != "" && result.AuthorizerRefreshToken != refreshToken.Token {
+				err = m.Store.Set(ctx, refreshKey, &WxToken{Token: result.AuthorizerRefreshToken})
+				if err != nil {
+					return nil, err
+				}
+			}
+			return &WxToken{result.AuthorizerAccessToken, result.expiresAt()}, nil
+		},
+	}
+}
+
+// SetComponentVerifyTicket save the component_verify_ticket pushed
+// by wx every 10 minutes to the callback of the platform
+func (m *WxTokenManager) SetComponentVerifyTicket(ctx context.Context, componentAppid, ticket string) error {
+	return m.Store.Set(ctx, "component_verify_ticket:"+componentAppid, &WxToken{Token: ticket})
+}
+
+// SetAuthorizerRefreshToken save the authorizer_refresh_token of an
+// authorizer, which is obtained by api_query_auth on authorization
+func (m *WxTokenManager) SetAuthorizerRefreshToken(ctx context.Context, componentAppid, authorizerAppid, refreshToken string) error {
+	return m.Store.Set(ctx, "authorizer_refresh_token:"+componentAppid+":"+authorizerAppid, &WxToken{Token: refreshToken})
+}
+
+// QueryAuth exchange the authorization code of an authorizer, pushed by
+// wx on authorization, for its tokens, which are saved, and return the
+// appid of the authorizer
+func (m *WxTokenManager) QueryAuth(ctx context.Context, componentAppid, componentSecret, authorizationCode string) (string, error) {
+	var result struct {
+		AuthorizationInfo struct {
+			wxTokenResult
+			AuthorizerAppid        string `json:"authorizer_appid"`
+			AuthorizerAccessToken  string `json:"authorizer_access_token"`
+			AuthorizerRefreshToken string `json:"authorizer_refresh_token"`
+		} `json:"authorization_info"`
+	}
+	api := WxAPI{
+		Method: "POST",
+		URI:    "/cgi-bin/component/api_query_auth",
+		Body: map[string]interface{}{
+			"component_appid":    componentAppid,
+			"authorization_code": authorizationCode,
+		},
+		Token: m.ComponentAccessToken(componentAppid, componentSecret),
+	}
+	if err := api.Fetch(ctx, &result); err != nil {
+		return "", err
+	}
+
+	info := result.AuthorizationInfo
+	if info.AuthorizerAppid == "" || info.AuthorizerRefreshToken == "" {
+		return "", ErrWxAuthorizationInvalid
+	}
+	err := m.SetAuthorizerRefreshToken(ctx, componentAppid, info.AuthorizerAppid, info.AuthorizerRefreshToken)
+	if err != nil {
+		return "", err
+	}
+	err = m.set(ctx, "authorizer_access_token:"+componentAppid+":"+info.AuthorizerAppid, &WxToken{info.AuthorizerAccessToken, info.expiresAt()})
+	if err != nil {
+		return "", err
+	}
+	return info.AuthorizerAppid, nil
+}
+
+// Token return a cached token, or refresh it if it expires soon
+func (s *WxTokenSource) Token(ctx context.Context) (string, error) {
+	return s.token(ctx, "")
+}
+
+// token is refreshed if it is rejected, unless it has been
+// refreshed by others
+func (s *WxTokenSource) token(ctx context.Context, rejected string) (string, error) {
+	m := s.m
+	if t, ok := m.cached(s.key); ok && t.Token != rejected {
+		return t.Token, nil
+	}
+
+	lock := m.lock(s.key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// refreshed by another goroutine while waiting
+	if t, ok := m.cached(s.key); ok && t.Token != rejected {
+		return t.Token, nil
+	}
+
+	// or by another replica
+	t, err := m.Store.Get(ctx, s.key)
+	if err != nil {
+		return "", err
+	}
+	if t == nil || !m.fresh(t) || t.Token == rejected {
+		t, err = s.refresh(ctx)
+		if err != nil {
+			return "", err
+		}
+		if err := m.set(ctx, s.key, t); err != nil {
+			return "", err
+		}
+		log.Info().Str("key", s.key).Time("expiresAt", t.ExpiresAt).Msg("wx token refreshed")
+		return t.Token, nil
+	}
+
+	m.mu.Lock()
+	m.cache[s.key] = *t
+	m.mu.Unlock()
+	return t.Token, nil
+}
+
+// set a token to the Store and the cache
+func (m *WxTokenManager) set(ctx context.Context, key string, t *WxToken) error {
+	if err := m.Store.Set(ctx, key, t); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.cache[key] = *t
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *WxTokenManager) cached(key string) (WxToken, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.cache[key]
+	if !ok || !m.fresh(&t) {
+		return WxToken{}, false
+	}
+	return t, true
+}
+
+func (m *WxTokenManager) fresh(t *WxToken) bool {
+	return t.ExpiresAt.IsZero() || time.Now().Add(m.RefreshBefore).Before(t.ExpiresAt)
+}
+
+func (m *WxTokenManager) lock(key string) *sync.Mutex {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.locks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		m.locks[key] = l
+	}
+	return l
+}
@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWxTokenManager(t *testing.T) {
+	var issued int32
+	var mu sync.Mutex
+	valid := map[string]bool{}
+	issue := func(w http.ResponseWriter, name string, extra map[string]interface{}) {
+		token := fmt.Sprintf("%s-%d", name, atomic.AddInt32(&issued, 1))
+		mu.Lock()
+		valid[token] = true
+		mu.Unlock()
+		result := map[string]interface{}{name: token, "expires_in": 7200}
+		for k, v := range extra {
+			result[k] = v
+		}
+		json.NewEncoder(w).Encode(result)
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+
+		switch r.URL.Path {
+		case "/cgi-bin/token":
+			if r.URL.Query().Get("secret") != "secret" {
+				w.Write([]byte(`{"errcode":40125,"errmsg":"invalid appsecret"}`))
+				return
+			}
+			issue(w, "access_token", nil)
+			return
+		case "/cgi-bin/component/api_component_token":
+			if body["component_verify_ticket"] != "ticket" {
+				w.Write([]byte(`{"errcode":61006,"errmsg":"component ticket is invalid"}`))
+				return
+			}
+			issue(w, "component_access_token", nil)
+			return
+		case "/cgi-bin/component/api_authorizer_token":
+			mu.Lock()
+			ok := valid[r.URL.Query().Get("component_access_token")]
+			mu.Unlock()
+			if !ok || body["authorizer_refresh_token"] != "refresh-1" {
+				w.Write([]byte(`{"errcode":40001,"errmsg":"invalid credential"}`))
+				return
+			}
+			issue(w, "authorizer_access_token", map[string]interface{}{
+				"authorizer_refresh_token": "refresh-2",
+			})
+			return
+		}
+
+		mu.Lock()
+		ok := valid[r.URL.Query().Get("access_token")]
+		mu.Unlock()
+		if !ok {
+			w.Write([]byte(`{"errcode":42001,"errmsg":"access_token expired"}`))
+			return
+		}
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok","hello":"world"}`))
+	}))
+	defer s.Close()
+
+	origin := wxURL
+	wxURL = s.URL
+	defer func() { wxURL = origin }()
+
+	ctx := context.Background()
+	m := NewWxTokenManager(nil)
+	source := m.AccessToken("appid", "secret")
+
+	// cached
+	var result struct {
+		Hello string
+	}
+	for i := 0; i < 3; i++ {
+		api := WxAPI{URI: "/cgi-bin/hello", Token: source}
+		if err := api.Fetch(ctx, &result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if result.Hello != "world" || atomic.LoadInt32(&issued) != 1 {
+		t.Errorf("expect 1 token issued, but get %d", issued)
+	}
+
+	// rejected by wx, refreshed and retried once
+	mu.Lock()
+	valid = map[string]bool{}
+	mu.Unlock()
+	api := WxAPI{URI: "/cgi-bin/hello", Token: source}
+	if err := api.Fetch(ctx, &result); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&issued) != 2 {
+		t.Errorf("expect 2 tokens issued, but get %d", issued)
+	}
+
+	// refreshed early
+	m.RefreshBefore = 2 * time.Hour
+	token, err := source.Token(ctx)
+	if err != nil || token != "access_token-3" {
+		t.Errorf("expect access_token-3, but get %s, %v", token, err)
+	}
+	m.RefreshBefore = 5 * time.Minute
+
+	// errors of wx
+	_, err = m.AccessToken("other", "wrong").Token(ctx)
+	if wErr, ok := err.(*WxError); !ok || wErr.Errcode != 40125 {
+		t.Errorf("expect errcode 40125, but get %v", err)
+	}
+
+	// third-party platforms
+	authorizer := m.AuthorizerAccessToken("component", "secret", "authorizer")
+	if _, err := authorizer.Token(ctx); err != ErrWxRefreshTokenNotFound {
+		t.Errorf("expect ErrWxRefreshTokenNotFound, but get %v", err)
+	}
+	m.SetAuthorizerRefreshToken(ctx, "component", "authorizer", "refresh-1")
+	if _, err := authorizer.Token(ctx); err != ErrWxTicketNotFound {
+		t.Errorf("expect ErrWxTicketNotFound, but get %v", err)
+	}
+	m.SetComponentVerifyTicket(ctx, "component", "ticket")
+	token, err = authorizer.Token(ctx)
+	if err != nil || token != "authorizer_access_token-5" {
+		t.Errorf("expect authorizer_access_token-5, but get %s, %v", token, err)
+	}
+	refreshToken, _ := m.Store.Get(ctx, "authorizer_refresh_token:component:authorizer")
+	if refreshToken.Token != "refresh-2" {
+		t.Errorf("expect refresh-2, but get %s", refreshToken.Token)
+	}
+
+	// shared by the store
+	other := NewWxTokenManager(m.Store)
+	token, err = other.AccessToken("appid", "secret").Token(ctx)
+	if err != nil || token != "access_token-3" {
+		t.Errorf("expect access_token-3, but get %s, %v", token, err)
+	}
+}
+
+func TestWxTokenManagerQueryAuth(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+
+		switch r.URL.Path {
+		case "/cgi-bin/component/api_component_token":
+			w.Write([]byte(`{"component_access_token":"component","expires_in":7200}`))
+		case "/cgi-bin/component/api_query_auth":
+			if body["authorization_code"] == "empty" {
+				w.Write([]byte(`{"authorization_info":{"authorizer_appid":"authorizer"}}`))
+				return
+			}
+			w.Write([]byte(`{"authorization_info":{"authorizer_appid":"authorizer","authorizer_access_token":"access","expires_in":7200,"authorizer_refresh_token":"refresh"}}`))
+		}
+	}))
+	defer s.Close()
+
+	origin := wxURL
+	wxURL = s.URL
+	defer func() { wxURL = origin }()
+
+	ctx := context.Background()
+	m := NewWxTokenManager(nil)
+	m.SetComponentVerifyTicket(ctx, "component", "ticket")
+
+	if _, err := m.QueryAuth(ctx, "component", "secret", "empty"); err != ErrWxAuthorizationInvalid {
+		t.Errorf("expect ErrWxAuthorizationInvalid, but get %v", err)
+	}
+	if refreshToken, _ := m.Store.Get(ctx, "authorizer_refresh_token:component:authorizer"); refreshToken != nil {
+		t.Errorf("expect no refresh token saved, but get %s", refreshToken.Token)
+	}
+
+	appid, err := m.QueryAuth(ctx, "component", "secret", "code")
+	if err != nil || appid != "authorizer" {
+		t.Errorf("expect authorizer, but get %s, %v", appid, err)
+	}
+	token, err := m.AuthorizerAccessToken("component", "secret", "authorizer").Token(ctx)
+	if err != nil || token != "access" {
+		t.Errorf("expect access, but get %s, %v", token, err)
+	}
+}
@@ -0,0 +1,228 @@
+package brick
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+type rule struct {
+	name  string
+	param string
+}
+
+// compiled regex rules
+var regexps sync.Map
+
+// parseRules split the validate tag by comma, regex takes the rest of the tag
+func parseRules(tag string) []rule {
+	var rules []rule
+	for tag != "" {
+		var part string
+		if strings.HasPrefix(tag, "regex=") {
+			part, tag = tag, ""
+		} else if i := strings.Index(tag, ","); i >= 0 {
+			part, tag = tag[:i], tag[i+1:]
+		} else {
+			part, tag = tag, ""
+		}
+
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		r := rule{name: kv[0]}
+		if len(kv) == 2 {
+			r.param = kv[1]
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// fieldName for error messages, prefer the name of the binding tags
+func fieldName(sf reflect.StructField) string {
+	for _, key := range []string{"json", "path", "query", "header", "form"} {
+		name := strings.Split(sf.Tag.Get(key), ",")[0]
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return sf.Name
+}
+
+// Validate check v, a struct or pointer to struct, by the validate tag:
+//
+//	required      non-zero value, non-nil pointer, non-empty slice or map
+//	min=n,max=n   bounds of numbers, or length of strings, slices and maps
+//	enum=a|b|c    one of the values
+//	regex=^\w+$   strings match the regexp, it must be the last rule
+//
+// Rules other than required are skipped for absent values (nil pointers,
+// slices and maps) only, zero values of other fields are checked, so
+// optional fields are pointers. Nested structs, pointers to structs and
+// slices of structs are validated recursively.
+// A *BindError is returned if any field is rejected.
+func Validate(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		log.Panic().Msgf("expect a struct, but get %T", v)
+	}
+
+	var fields []FieldError
+	validateStruct(rv, "", &fields)
+	if len(fields) > 0 {
+		return newBindError(fields)
+	}
+	return nil
+}
+
+func validateStruct(rv reflect.Value, prefix string, fields *[]FieldError) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		fv := rv.Field(i)
+
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			validateStruct(fv, prefix, fields)
+			continue
+		}
+		if sf.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		name := prefix + fieldName(sf)
+		if msg := validateField(fv, parseRules(sf.Tag.Get("validate"))); msg != "" {
+			*fields = append(*fields, FieldError{Field: name, Msg: msg})
+			continue
+		}
+		validateNested(fv, name, fields)
+	}
+}
+
+func validateNested(fv reflect.Value, name string, fields *[]FieldError) {
+	for fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return
+		}
+		fv = fv.Elem()
+	}
+
+	switch fv.Kind() {
+	case reflect.Struct:
+		validateStruct(fv, name+".", fields)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < fv.Len(); i++ {
+			validateNested(fv.Index(i), fmt.Sprintf("%s[%d]", name, i), fields)
+		}
+	}
+}
+
+// validateField return the message of the first broken rule
+func validateField(fv reflect.Value, rules []rule) string {
+	if len(rules) == 0 {
+		return ""
+	}
+
+	if fv.IsZero() || (fv.Kind() == reflect.Slice || fv.Kind() == reflect.Map) && fv.Len() == 0 {
+		for _, r := range rules {
+			if r.name == "required" {
+				return "required"
+			}
+		}
+	}
+
+	// absent optional values, zero values of others are checked
+	switch fv.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		if fv.IsNil() {
+			return ""
+		}
+	}
+	for fv.Kind() == reflect.Ptr {
+		fv = fv.Elem()
+		if fv.Kind() == reflect.Ptr && fv.IsNil() {
+			return ""
+		}
+	}
+
+	for _, r := range rules {
+		switch r.name {
+		case "required":
+		case "min", "max":
+			bound, err := strconv.ParseFloat(r.param, 64)
+			if err != nil {
+				log.Panic().Msgf("invalid %s rule: %s", r.name, r.param)
+			}
+			n, isLen := measure(fv)
+			if r.name == "min" && n < bound {
+				if isLen {
+					return fmt.Sprintf("length must be at least %s", r.param)
+				}
+				return fmt.Sprintf("must be at least %s", r.param)
+			}
+			if r.name == "max" && n > bound {
+				if isLen {
+					return fmt.Sprintf("length must be at most %s", r.param)
+				}
+				return fmt.Sprintf("must be at most %s", r.param)
+			}
+		case "enum":
+			value := fmt.Sprint(fv.Interface())
+			found := false
+			for _, e := range strings.Split(r.param, "|") {
+				if e == value {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Sprintf("must be one of %s", strings.Replace(r.param, "|", ", ", -1))
+			}
+		case "regex":
+			if fv.Kind() != reflect.String {
+				log.Panic().Msgf("regex rule expect a string, but get %s", fv.Type())
+			}
+			re, ok := regexps.Load(r.param)
+			if !ok {
+				re, _ = regexps.LoadOrStore(r.param, regexp.MustCompile(r.param))
+			}
+			if !re.(*regexp.Regexp).MatchString(fv.String()) {
+				return fmt.Sprintf("must match %s", r.param)
+			}
+		default:
+			log.Panic().Msgf("unknown validate rule: %s", r.name)
+		}
+	}
+
+	return ""
+}
+
+// measure a value for min/max, the length of strings, slices and maps,
+// or the value of numbers
+func measure(fv reflect.Value) (float64, bool) {
+	switch fv.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(fv.String())), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(fv.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), false
+	default:
+		log.Panic().Msgf("min/max rule expect a number, string, slice or map, but get %s", fv.Type())
+	}
+	return 0, false
+}